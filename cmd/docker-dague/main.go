@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 
@@ -14,25 +16,44 @@ import (
 	"github.com/eunomie/dague/config"
 	"github.com/eunomie/dague/internal"
 	"github.com/eunomie/dague/internal/commands"
+	"github.com/eunomie/dague/internal/ui"
 )
 
 const (
 	PluginName = "dague"
+
+	// lenientAnnotation marks the commands loading the configuration without the strict mode.
+	lenientAnnotation = "dague.lenient"
+	// noConfigAnnotation marks the commands not loading the configuration, like init writing it.
+	noConfigAnnotation = "dague.noconfig"
 )
 
 func pluginMain() {
-	plugin.Run(func(dockerCli command.Cli) *cobra.Command {
-		var conf config.Dague
+	run(func(dockerCli command.Cli) *cobra.Command {
+		var (
+			conf     config.Dague
+			loadOpts config.Options
+			dir      string
+		)
 		c := &cobra.Command{
 			Short:            "Docker Dague",
 			Use:              PluginName,
 			TraverseChildren: true,
 			PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-				c, err := config.Load(cmd.Context())
+				if err := enterProject(dir, &loadOpts); err != nil {
+					return err
+				}
+				if cmd.Annotations[noConfigAnnotation] != "" {
+					return nil
+				}
+				// config validate reports the unknown keys with all the other problems
+				loadOpts.Strict = cmd.Annotations[lenientAnnotation] == ""
+				c, err := config.Load(cmd.Context(), loadOpts)
 				if err != nil {
 					return err
 				}
 				conf = c
+				ui.Interactive = conf.Interactive
 				return nil
 			},
 			RunE: func(cmd *cobra.Command, args []string) error {
@@ -46,6 +67,12 @@ func pluginMain() {
 				}
 			},
 		}
+		c.PersistentFlags().StringVarP(&dir, "directory", "C", "", "run as if started in this directory")
+		c.PersistentFlags().StringVar(&loadOpts.File, "config", "", "configuration file, .dague.yml found in the current directory or its parents by default")
+		c.PersistentFlags().StringVar(&loadOpts.Profile, "profile", os.Getenv("DAGUE_PROFILE"), "profile to merge over the configuration, defaults to $DAGUE_PROFILE")
+		c.PersistentFlags().StringArrayVar(&loadOpts.Vars, "var", nil, "variable as KEY=VALUE, overriding the dotenv files and the vars section, can be repeated")
+		c.PersistentFlags().StringArrayVar(&loadOpts.EnvFiles, "env-file", nil, "dotenv file read after the ones of the configuration, can be repeated")
+
 		originalPreRun := c.PersistentPreRunE
 		c.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
 			if err := plugin.PersistentPreRunE(cmd, args); err != nil {
@@ -70,35 +97,23 @@ func pluginMain() {
 					fmt.Println("git commit:", internal.Commit)
 				},
 			},
-			&cobra.Command{
+			modulesCommand(l, &conf, &cobra.Command{
 				Use:   "go:lint",
 				Short: "Lint Go code (--help for subcommands)",
 				Long: `Subcommands:
   go:lint:govuln   Lint Go code using govulncheck
   go:lint:golangci Lint Go code using golangci`,
-				Args: cobra.NoArgs,
-				RunE: func(cmd *cobra.Command, args []string) error {
-					return l.Run(cmd.Context(), "go:lint", args, &conf, nil)
-				},
-			},
-			&cobra.Command{
+			}, nil),
+			modulesCommand(l, &conf, &cobra.Command{
 				Use:    "go:lint:govuln",
 				Hidden: true,
 				Short:  "Lint Go code using govulncheck",
-				Args:   cobra.NoArgs,
-				RunE: func(cmd *cobra.Command, args []string) error {
-					return l.Run(cmd.Context(), "go:lint:govuln", args, &conf, nil)
-				},
-			},
-			&cobra.Command{
+			}, nil),
+			modulesCommand(l, &conf, &cobra.Command{
 				Use:    "go:lint:golangci",
 				Hidden: true,
 				Short:  "Lint Go code using golangci",
-				Args:   cobra.NoArgs,
-				RunE: func(cmd *cobra.Command, args []string) error {
-					return l.Run(cmd.Context(), "go:lint:golangci", args, &conf, nil)
-				},
-			},
+			}, nil),
 			func() *cobra.Command {
 				type goFmtOptions struct {
 					check bool
@@ -164,16 +179,12 @@ func pluginMain() {
 					return l.Run(cmd.Context(), "go:imports:print", args, &conf, nil)
 				},
 			},
-			&cobra.Command{
+			modulesCommand(l, &conf, &cobra.Command{
 				Use:   "go:mod",
 				Short: "Run go mod download and go mod tidy (--help for subcommands)",
 				Long: `Subcommands:
   go:mod:download  Download go modules`,
-				Args: cobra.NoArgs,
-				RunE: func(cmd *cobra.Command, args []string) error {
-					return l.Run(cmd.Context(), "go:mod", args, &conf, nil)
-				},
-			},
+			}, nil),
 			&cobra.Command{
 				Use:    "go:mode:download",
 				Hidden: true,
@@ -183,46 +194,68 @@ func pluginMain() {
 					return l.Run(cmd.Context(), "go:mod:download", args, &conf, nil)
 				},
 			},
-			&cobra.Command{
+			modulesCommand(l, &conf, &cobra.Command{
 				Use:   "go:test",
 				Short: "Run go tests",
-				Args:  cobra.NoArgs,
-				RunE: func(cmd *cobra.Command, args []string) error {
-					return l.Run(cmd.Context(), "go:test", args, &conf, nil)
-				},
-			},
+			}, nil),
 
 			func() *cobra.Command {
-				type goDocOptions struct {
-					check bool
+				check := false
+				cmd := modulesCommand(l, &conf, &cobra.Command{
+					Use:   "go:doc",
+					Short: "Generate Go documentation into readme files",
+				}, func() map[string]interface{} {
+					return map[string]interface{}{"check": check}
+				})
+
+				flags := cmd.Flags()
+				flags.BoolVar(&check, "check", false, "check the documentation is up-to-date")
+
+				return cmd
+			}(),
+
+			func() *cobra.Command {
+				type goBuildOptions struct {
+					all        bool
+					report     bool
+					reportSave string
+					reportBase string
 				}
 
-				opts := goDocOptions{
-					check: false,
+				opts := goBuildOptions{
+					all: false,
 				}
 				cmd := &cobra.Command{
-					Use:   "go:doc",
-					Short: "Generate Go documentation into readme files",
-					Args:  cobra.NoArgs,
+					Use:   "go:build [TARGET...]",
+					Short: "Compile go code",
 					RunE: func(cmd *cobra.Command, args []string) error {
-						return l.Run(cmd.Context(), "go:doc", args, &conf, map[string]interface{}{
-							"check": opts.check,
+						if opts.all && len(args) > 0 {
+							return fmt.Errorf("--all can't be used with a list of targets")
+						}
+						return l.Run(cmd.Context(), "go:build", args, &conf, map[string]interface{}{
+							"all":        opts.all,
+							"report":     opts.report,
+							"reportSave": opts.reportSave,
+							"reportBase": opts.reportBase,
 						})
 					},
 				}
 
 				flags := cmd.Flags()
-				flags.BoolVar(&opts.check, "check", false, "check the documentation is up-to-date")
+				flags.BoolVar(&opts.all, "all", false, "build all the targets")
+				flags.BoolVar(&opts.report, "report", false, "print size and build information of each binary")
+				flags.StringVar(&opts.reportSave, "report-save", "", "save the report as JSON to the specified file")
+				flags.StringVar(&opts.reportBase, "report-base", "", "compare with a report saved with --report-save or a release.json manifest")
 
 				return cmd
 			}(),
 
 			&cobra.Command{
-				Use:   "go:build [TARGET]",
-				Short: "Compile go code",
+				Use:   "go:install [TARGET]",
+				Short: "Build a target for the host platform and install it, as a docker cli plugin or in GOBIN",
 				Args:  cobra.MaximumNArgs(1),
 				RunE: func(cmd *cobra.Command, args []string) error {
-					return l.Run(cmd.Context(), "go:build", args, &conf, nil)
+					return l.Run(cmd.Context(), "go:install", args, &conf, nil)
 				},
 			},
 
@@ -235,6 +268,92 @@ func pluginMain() {
 				},
 			},
 
+			func() *cobra.Command {
+				type releaseBumpOptions struct {
+					dryRun bool
+				}
+
+				opts := releaseBumpOptions{
+					dryRun: false,
+				}
+				cmd := &cobra.Command{
+					Use:       "release:bump [major|minor|patch|auto]",
+					Short:     "Tag the next version and update the changelog based on conventional commits",
+					Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+					ValidArgs: []string{"major", "minor", "patch", "auto"},
+					RunE: func(cmd *cobra.Command, args []string) error {
+						return l.Run(cmd.Context(), "release:bump", args, &conf, map[string]interface{}{
+							"dryRun": opts.dryRun,
+						})
+					},
+				}
+
+				flags := cmd.Flags()
+				flags.BoolVar(&opts.dryRun, "dry-run", false, "print the next version and changelog without writing them")
+
+				return cmd
+			}(),
+
+			&cobra.Command{
+				Use:   "go:release [TARGET]",
+				Short: "Build a target, write the checksums and render the Homebrew formula and Scoop manifest",
+				Args:  cobra.MaximumNArgs(1),
+				RunE: func(cmd *cobra.Command, args []string) error {
+					return l.Run(cmd.Context(), "go:release", args, &conf, nil)
+				},
+			},
+
+			func() *cobra.Command {
+				type initOptions struct {
+					force bool
+				}
+
+				opts := initOptions{
+					force: false,
+				}
+				cmd := &cobra.Command{
+					Use:         "init",
+					Short:       "Write a starter .dague.yml configuration detected from the project",
+					Annotations: map[string]string{noConfigAnnotation: "true"},
+					Args:        cobra.NoArgs,
+					RunE: func(cmd *cobra.Command, args []string) error {
+						return l.Run(cmd.Context(), "init", args, &conf, map[string]interface{}{
+							"force": opts.force,
+						})
+					},
+				}
+
+				flags := cmd.Flags()
+				flags.BoolVar(&opts.force, "force", false, "overwrite the existing configuration file")
+
+				return cmd
+			}(),
+
+			func() *cobra.Command {
+				cmd := &cobra.Command{
+					Use:   "config",
+					Short: "Manage the configuration",
+				}
+				cmd.AddCommand(&cobra.Command{
+					Use:         "validate",
+					Short:       "Validate the configuration",
+					Annotations: map[string]string{lenientAnnotation: "true"},
+					Args:        cobra.NoArgs,
+					RunE: func(cmd *cobra.Command, args []string) error {
+						return l.Run(cmd.Context(), "config:validate", args, &conf, nil)
+					},
+				})
+				cmd.AddCommand(&cobra.Command{
+					Use:   "schema",
+					Short: "Print the JSON Schema of the configuration",
+					Args:  cobra.NoArgs,
+					RunE: func(cmd *cobra.Command, args []string) error {
+						return l.Run(cmd.Context(), "config:schema", args, &conf, nil)
+					},
+				})
+				return cmd
+			}(),
+
 			&cobra.Command{
 				Use:   "task [TASK]",
 				Short: "Run tasks",
@@ -252,6 +371,97 @@ func pluginMain() {
 	})
 }
 
+// run runs the plugin like plugin.Run, but the errors are printed to the masked error output, as they can contain
+// secrets, and the outputs are flushed before exiting so the end of the masked outputs is not lost.
+func run(makeCmd func(command.Cli) *cobra.Command, meta manager.Metadata) {
+	dockerCli, err := command.NewDockerCli()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	cmd := makeCmd(dockerCli)
+	cmd.SetErr(ui.ErrOut)
+	code := 0
+	if err := plugin.RunPlugin(dockerCli, cmd, meta); err != nil {
+		code = 1
+		var sterr cli.StatusError
+		switch {
+		case errors.As(err, &sterr):
+			if sterr.Status != "" {
+				fmt.Fprintln(ui.Stderr, sterr.Status)
+			}
+			// a status error is always an error, exiting with 0 would hide it
+			if sterr.StatusCode != 0 {
+				code = sterr.StatusCode
+			}
+		default:
+			fmt.Fprintln(ui.Stderr, err)
+		}
+	}
+	ui.Flush()
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+// modulesCommand completes the command to run on the Go modules selected with --module, all by default. The options
+// of the command, if any, are given with the selected modules.
+func modulesCommand(l *commands.List, conf *config.Dague, cmd *cobra.Command, opts func() map[string]interface{}) *cobra.Command {
+	var modules []string
+	cmd.Args = cobra.NoArgs
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+		cmdOpts := map[string]interface{}{}
+		if opts != nil {
+			cmdOpts = opts()
+		}
+		cmdOpts["modules"] = modules
+		return l.Run(c.Context(), cmd.Use, args, conf, cmdOpts)
+	}
+	cmd.Flags().StringArrayVar(&modules, "module", nil, "module to run on, by directory or module path, all by default, can be repeated")
+	return cmd
+}
+
+// enterProject changes the current directory to the root of the project, the directory of the configuration file, so
+// all the host paths are relative to it. The configuration file is looked for from dir if not set, and the defaults
+// are used if none is found.
+func enterProject(dir string, opts *config.Options) error {
+	if dir != "" {
+		if err := os.Chdir(dir); err != nil {
+			return err
+		}
+	}
+	// dotenv files are relative to the directory the command is run from
+	for i, f := range opts.EnvFiles {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return err
+		}
+		opts.EnvFiles[i] = abs
+	}
+	file := opts.File
+	if file == "" {
+		found, err := config.Find(".")
+		if errors.Is(err, os.ErrNotExist) {
+			// without configuration file, the current directory is the root of the project
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		file = found
+	}
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(filepath.Dir(file)); err != nil {
+		return err
+	}
+	opts.File = filepath.Base(file)
+	return nil
+}
+
 func main() {
 	if plugin.RunningStandalone() {
 		os.Args = append([]string{"docker", "dague"}, os.Args[1:]...)
@@ -3,96 +3,202 @@ package config
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
-	"github.com/eunomie/dague/internal/shell"
-
 	"gopkg.in/yaml.v2"
+
+	"github.com/eunomie/dague/internal/shell"
 )
 
 type (
 	Dague struct {
-		Vars  map[string]string `yaml:"vars"`
-		Go    Go                `yaml:"go"`
-		Tasks Tasks             `yaml:"tasks"`
+		Include     []string          `yaml:"include" expand:"-" desc:"Files merged in order before this one, relative to this file"`
+		Dotenv      []string          `yaml:"dotenv" expand:"-" desc:"Dotenv files defining variables, overridden by vars, missing files are ignored"`
+		Vars        map[string]string `yaml:"vars" expand:"-" desc:"Variables available to the whole configuration, a value starting with 'shell ' is the output of the shell script"`
+		Go          Go                `yaml:"go" desc:"Go related configuration"`
+		Tasks       Tasks             `yaml:"tasks" expand:"lazy" desc:"Tasks to run on the host, by name"`
+		Secrets     map[string]Secret `yaml:"secrets" expand:"lazy" desc:"Secrets given to the containers of the targets and exec using them, by name, never cached nor printed"`
+		Profiles    map[string]Dague  `yaml:"profiles" expand:"-" desc:"Configurations merged over this one when the profile is selected, by name"`
+		Interactive bool              `yaml:"interactive" desc:"Ask to choose the target, task or exec when none is given, disable it in CI to fail instead"`
+
+		vars    *resolver
+		sources sources
+		// rendered are the sections already rendered, and if their lazy fields were.
+		rendered map[string]bool
 	}
 
 	Go struct {
-		Image  Image           `yaml:"image"`
-		AppDir string          `yaml:"appDir"`
-		Fmt    Fmt             `yaml:"fmt"`
-		Lint   Lint            `yaml:"lint"`
-		Build  Build           `yaml:"build"`
-		Exec   map[string]Exec `yaml:"exec"`
+		Image   Image           `yaml:"image" desc:"Base image used to build and run tools"`
+		AppDir  string          `yaml:"appDir" desc:"Directory to mount the sources in the container"`
+		Modules Modules         `yaml:"modules" desc:"Configuration of the Go modules"`
+		Sources Sources         `yaml:"sources" desc:"Files of the project uploaded to the containers, the ones of .dagueignore are excluded"`
+		Fmt     Fmt             `yaml:"fmt" desc:"Configuration of the formatters"`
+		Lint    Lint            `yaml:"lint" desc:"Configuration of the linters"`
+		Build   Build           `yaml:"build" desc:"Build configuration"`
+		Exec    map[string]Exec `yaml:"exec" expand:"lazy" desc:"Scripts to run inside the build container, by name"`
+		Release Release         `yaml:"release" expand:"lazy" desc:"Release configuration"`
+	}
+
+	Sources struct {
+		Include   []string `yaml:"include" desc:"Patterns of the files to upload, all by default"`
+		Exclude   []string `yaml:"exclude" desc:"Patterns of the files to not upload, after the ones of .dagueignore"`
+		Gitignore bool     `yaml:"gitignore" desc:"Also exclude the files ignored by the .gitignore file of the project"`
+		GoOnly    bool     `yaml:"goOnly" desc:"Only upload the Go inputs: module files, Go, cgo, assembly and embedded files, testdata, linter configurations and readme files"`
+	}
+
+	Modules struct {
+		Private Private `yaml:"private" desc:"Access to private modules, for all the containers"`
+	}
+
+	Private struct {
+		Patterns   []string `yaml:"patterns" desc:"Module path patterns of the private modules, set as GOPRIVATE and GONOSUMDB"`
+		Proxy      string   `yaml:"proxy" desc:"GOPROXY to use"`
+		Netrc      string   `yaml:"netrc" desc:"Host .netrc file with the credentials of the repositories, mounted as a secret"`
+		Token      Token    `yaml:"token" desc:"Token to access the repositories over https, mounted as a .netrc secret"`
+		SSH        bool     `yaml:"ssh" desc:"Forward the host SSH agent and fetch the private modules with git over ssh"`
+		KnownHosts string   `yaml:"knownHosts" desc:"Host known_hosts file with the keys of the ssh hosts, ~/.ssh/known_hosts by default"`
+	}
+
+	Token struct {
+		Secret string `yaml:"secret" desc:"Name of the secret containing the token"`
+		Host   string `yaml:"host" desc:"Host of the repositories, github.com by default"`
+		Login  string `yaml:"login" desc:"Login to use with the token, x-access-token by default"`
+	}
+
+	Release struct {
+		Changelog  string     `yaml:"changelog" desc:"Changelog file updated and committed by release:bump, disabled if empty"`
+		Publishers Publishers `yaml:"publishers" desc:"Files rendered by go:release with the download URLs and digests of the binaries"`
+	}
+
+	Publishers struct {
+		URL      string    `yaml:"url" expand:"-" desc:"Go template of the download URLs, with Version, Tag, File, OS, Arch and Variant fields"`
+		Homebrew Publisher `yaml:"homebrew" desc:"Homebrew formula"`
+		Scoop    Publisher `yaml:"scoop" desc:"Scoop manifest"`
+	}
+
+	Publisher struct {
+		Output      string `yaml:"output" desc:"File to write, the publisher is only rendered if set"`
+		Template    string `yaml:"template" desc:"Custom Go template file used instead of the builtin one"`
+		Name        string `yaml:"name" desc:"Name of the installed binary, base name of the target path by default"`
+		Description string `yaml:"description" desc:"Description of the project"`
+		Homepage    string `yaml:"homepage" desc:"Homepage of the project"`
+		License     string `yaml:"license" desc:"License of the project"`
 	}
 
 	Image struct {
-		Src         string            `yaml:"src"`
-		AptPackages []string          `yaml:"aptPackages"`
-		ApkPackages []string          `yaml:"apkPackages"`
-		GoPackages  []string          `yaml:"goPackages"`
-		Mounts      map[string]string `yaml:"mounts"`
-		Env         map[string]string `yaml:"env"`
-		Caches      []Cache           `yaml:"caches"`
+		Src         string            `yaml:"src" desc:"Source of the image"`
+		AptPackages []string          `yaml:"aptPackages" desc:"APT packages to install, if debian based"`
+		ApkPackages []string          `yaml:"apkPackages" desc:"APK packages to install, if alpine based"`
+		GoPackages  []string          `yaml:"goPackages" desc:"Go packages to install"`
+		Mounts      map[string]string `yaml:"mounts" desc:"Host directories to mount, the key can use variables"`
+		Env         map[string]string `yaml:"env" desc:"Environment variables of the image"`
+		Caches      []Cache           `yaml:"caches" desc:"Cache volumes to mount"`
 	}
 
 	Cache struct {
-		Target string `yaml:"target"`
+		Target string `yaml:"target" desc:"Path of the cache in the container"`
 	}
 
 	Fmt struct {
-		Formatter string    `yaml:"formatter"`
-		Goimports Goimports `yaml:"goimports"`
+		Formatter string    `yaml:"formatter" desc:"Formatter to use, others than gofmt have to be installed with go.image.goPackages" enum:"gofmt,gofumpt"`
+		Goimports Goimports `yaml:"goimports" desc:"Configuration of goimports, run before the formatter"`
 	}
 
 	Goimports struct {
-		Locals []string `yaml:"locals"`
+		Locals []string `yaml:"locals" desc:"Local packages, grouped after 3rd party imports"`
 	}
 
 	Lint struct {
-		Govulncheck Govulncheck `yaml:"govulncheck"`
-		Golangci    Golangci    `yaml:"golangci"`
+		Govulncheck Govulncheck `yaml:"govulncheck" desc:"Configuration of govulncheck"`
+		Golangci    Golangci    `yaml:"golangci" desc:"Configuration of golangci-lint"`
 	}
 
 	Govulncheck struct {
-		Enable bool `yaml:"enable"`
+		Enable bool `yaml:"enable" desc:"Run govulncheck with go:lint"`
 	}
 
 	Golangci struct {
-		Enable bool   `yaml:"enable"`
-		Image  string `yaml:"image"`
+		Enable bool   `yaml:"enable" desc:"Run golangci-lint with go:lint"`
+		Image  string `yaml:"image" desc:"Golangci-lint image to use"`
 	}
 
 	Build struct {
-		Targets map[string]Target `yaml:"targets"`
+		Targets map[string]Target `yaml:"targets" expand:"lazy" desc:"Targets to build, by name"`
+		Cosign  Cosign            `yaml:"cosign" desc:"Configuration of cosign, used to sign the binaries"`
+	}
+
+	Cosign struct {
+		Image string `yaml:"image" desc:"Cosign image to use"`
 	}
 
 	Target struct {
-		Path      string            `yaml:"path"`
-		Out       string            `yaml:"out"`
-		Env       map[string]string `yaml:"env"`
-		Ldflags   string            `yaml:"ldflags"`
-		Platforms []string          `yaml:"platforms,omitempty"`
+		Extends        string            `yaml:"extends" desc:"Name of the target to inherit from"`
+		Abstract       bool              `yaml:"abstract" desc:"The target is only a base for extends, it can't be built"`
+		Path           string            `yaml:"path" desc:"Relative path of the main package to build"`
+		Out            string            `yaml:"out" desc:"Relative directory of the generated files"`
+		OutTemplate    string            `yaml:"outTemplate" expand:"-" desc:"Go template of the generated file names, with Name, OS, Arch, Variant, Version and Ext fields"`
+		Env            map[string]string `yaml:"env" expand:"build" desc:"Environment variables of the build, a value starting with 'shell ' is the output of the shell script"`
+		Ldflags        string            `yaml:"ldflags" expand:"build" desc:"Ldflags of the build, variables are expanded"`
+		Tags           []string          `yaml:"tags" desc:"Build tags"`
+		Gcflags        string            `yaml:"gcflags" expand:"build" desc:"Gcflags of the build, variables are expanded"`
+		Asmflags       string            `yaml:"asmflags" expand:"build" desc:"Asmflags of the build, variables are expanded"`
+		Trimpath       bool              `yaml:"trimpath" desc:"Remove file system paths from the binary"`
+		Buildmode      string            `yaml:"buildmode" desc:"Build mode" enum:"default,exe,pie,c-shared,c-archive,plugin"`
+		Mod            string            `yaml:"mod" desc:"Module download mode" enum:"readonly,vendor,mod"`
+		Pgo            string            `yaml:"pgo" expand:"build" desc:"Profile to use for profile-guided optimization, requires Go 1.20"`
+		VersionPackage string            `yaml:"versionPackage" desc:"Package whose Version, Commit, ShortCommit, Branch, Dirty and Date variables are set with -X ldflags"`
+		Plugin         bool              `yaml:"plugin" desc:"The binary is a docker cli plugin, installed by go:install in the docker cli-plugins directory"`
+		Platforms      []string          `yaml:"platforms,omitempty" desc:"Platforms to build, as os/arch[/variant], the local platform if empty"`
+		Sign           Sign              `yaml:"sign" desc:"Sign the binaries with cosign"`
+		Cgo            Cgo               `yaml:"cgo" desc:"Cross compile with cgo enabled"`
+		Secrets        []string          `yaml:"secrets" desc:"Names of the secrets given to the build container"`
+	}
+
+	Cgo struct {
+		Enable    bool   `yaml:"enable" desc:"Enable cgo, with a C cross toolchain"`
+		Toolchain string `yaml:"toolchain" desc:"C cross toolchain to use" enum:"zig"`
+		Static    bool   `yaml:"static" desc:"Link statically, using musl for linux"`
+		Cflags    string `yaml:"cflags" desc:"CGO_CFLAGS of the build"`
+	}
+
+	Sign struct {
+		Key         string `yaml:"key" expand:"build" desc:"Path of the cosign private key"`
+		PasswordEnv string `yaml:"passwordEnv" desc:"Environment variable containing the password of the key, COSIGN_PASSWORD by default"`
+		Bundle      bool   `yaml:"bundle" desc:"Also generate a bundle file"`
+	}
+
+	Secret struct {
+		Env   string `yaml:"env" desc:"Host environment variable containing the secret"`
+		File  string `yaml:"file" desc:"Host file containing the secret"`
+		Cmd   string `yaml:"cmd" expand:"script" desc:"Shell script printing the secret"`
+		Mount string `yaml:"mount" desc:"Path of the file containing the secret in the containers, instead of an environment variable named after the secret"`
 	}
 
 	Exec struct {
-		Deps   []string `yaml:"deps"`
-		Cmds   string   `yaml:"cmds"`
-		Export Export   `yaml:"export"`
+		Extends  string   `yaml:"extends" desc:"Name of the exec to inherit from"`
+		Abstract bool     `yaml:"abstract" desc:"The exec is only a base for extends, it can't be run"`
+		Deps     []string `yaml:"deps" desc:"Commands to run before"`
+		Cmds     string   `yaml:"cmds" expand:"script" desc:"Shell script to run inside the build container"`
+		Export   Export   `yaml:"export" desc:"Files to export to the host"`
+		Secrets  []string `yaml:"secrets" desc:"Names of the secrets given to the container"`
 	}
 
 	Export struct {
-		Pattern string `yaml:"pattern"`
-		Path    string `yaml:"path"`
+		Pattern string `yaml:"pattern" desc:"Pattern of the files to export"`
+		Path    string `yaml:"path" desc:"Directory to export the files to"`
 	}
 
 	Tasks map[string]Task
 
 	Task struct {
-		Deps []string `yaml:"deps"`
-		Cmds string   `yaml:"cmds"`
+		Extends  string   `yaml:"extends" desc:"Name of the task to inherit from"`
+		Abstract bool     `yaml:"abstract" desc:"The task is only a base for extends, it can't be run"`
+		Deps     []string `yaml:"deps" desc:"Commands to run before"`
+		Cmds     string   `yaml:"cmds" expand:"script" desc:"Shell script to run on the host"`
 	}
 )
 
@@ -103,57 +209,262 @@ const (
 //go:embed .dague.default.yml
 var defaults []byte
 
-func Load(ctx context.Context) (Dague, error) {
-	configData, err := os.ReadFile(defaultConfigFile)
+// Options configures how the configuration is loaded.
+type Options struct {
+	// File is the configuration file, .dague.yml by default.
+	File string
+	// Profile is the name of the profile to merge over the configuration, from the profiles section and from the
+	// .dague.<profile>.yml file.
+	Profile string
+	// Vars are variables, as KEY=VALUE, overriding all the others.
+	Vars []string
+	// EnvFiles are dotenv files read after the ones of the configuration. They must exist.
+	EnvFiles []string
+	// Strict fails on the unknown and duplicated keys, and on the merges of values of different types. Without it,
+	// they are reported by Validate with the other problems.
+	Strict bool
+}
+
+// Find looks for the configuration file in the directory and its parents, up to the root of the git repository. It
+// returns the absolute path of the file.
+func Find(dir string) (string, error) {
+	start, err := filepath.Abs(dir)
 	if err != nil {
-		return Dague{}, fmt.Errorf("could not read .dague.yml config file: %w", err)
+		return "", err
+	}
+	dir = start
+	for {
+		file := filepath.Join(dir, defaultConfigFile)
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+		parent := filepath.Dir(dir)
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil || parent == dir {
+			return "", fmt.Errorf("could not find %s in %s or its parents: %w", defaultConfigFile, start, os.ErrNotExist)
+		}
+		dir = parent
 	}
+}
 
-	merged, err := YAML([][]byte{defaults, configData}, false)
+func Load(ctx context.Context, opts Options) (Dague, error) {
+	file := opts.File
+	if file == "" {
+		file = defaultConfigFile
+	}
+	// files are in merge order: the included files, then the configuration file which has the priority
+	var files []*source
+	configData, err := os.ReadFile(file)
+	switch {
+	case err == nil:
+		src, err := parseSource(file, configData)
+		if err != nil {
+			return Dague{}, err
+		}
+		included, err := loadIncludes(src, nil)
+		if err != nil {
+			return Dague{}, err
+		}
+		files = append(included, src)
+	case opts.File == "" && errors.Is(err, os.ErrNotExist):
+		// without configuration file, the defaults are used
+	default:
+		return Dague{}, fmt.Errorf("could not read %s config file: %w", file, err)
+	}
+
+	var srcs sources
+	data := [][]byte{defaults}
+	for i := len(files) - 1; i >= 0; i-- {
+		srcs = append(srcs, files[i])
+	}
+	for _, s := range files {
+		data = append(data, s.data)
+	}
+
+	var profileSrc *source
+	if opts.Profile != "" {
+		profileFile := fmt.Sprintf(".dague.%s.yml", opts.Profile)
+		profileData, err := os.ReadFile(profileFile)
+		if err != nil && !os.IsNotExist(err) {
+			return Dague{}, fmt.Errorf("could not read %s profile file: %w", profileFile, err)
+		}
+		if err == nil {
+			if profileSrc, err = parseSource(profileFile, profileData); err != nil {
+				return Dague{}, err
+			}
+			srcs = append(sources{profileSrc}, srcs...)
+		}
+	}
+	if opts.Strict {
+		if problems := srcs.checkKeys(); len(problems) > 0 {
+			return Dague{}, problems
+		}
+	}
+
+	// merge directives are kept until the profile and extends are applied
+	tree, _, err := mergeSources(data, opts.Strict)
 	if err != nil {
 		return Dague{}, fmt.Errorf("could not merge .dague.yml with defaults: %w", err)
 	}
+	if tree, err = applyProfile(tree, opts.Profile, profileSrc); err != nil {
+		return Dague{}, err
+	}
+	if err := resolveExtends(tree, srcs); err != nil {
+		return Dague{}, err
+	}
+	resolved, err := yaml.Marshal(clean(tree))
+	if err != nil {
+		return Dague{}, err
+	}
 
 	var dague Dague
-	err = yaml.Unmarshal(merged.Bytes(), &dague)
+	err = yaml.Unmarshal(resolved, &dague)
 	if err != nil {
 		return Dague{}, fmt.Errorf("could not parse .dague.yml config file: %w", err)
 	}
 
-	// post step to expand vars
-	vars := map[string]string{}
-	var res string
-	for k, v := range dague.Vars {
-		if strings.HasPrefix(v, "shell ") {
-			res, err = shell.Interpret(ctx, strings.TrimPrefix(v, "shell"), nil)
-		} else {
-			res, err = shell.Expand(v, nil)
+	// vars are resolved on first use, built-in variables can be used and overridden
+	dotenv, err := readDotenv(dague.Dotenv, opts.EnvFiles)
+	if err != nil {
+		return Dague{}, err
+	}
+	overrides, err := parseVars(opts.Vars)
+	if err != nil {
+		return Dague{}, err
+	}
+	dague.vars = newResolver(ctx, dague.Vars, dotenv, overrides)
+	dague.sources = srcs
+	// the sections are rendered by the commands using them
+	dague.rendered = map[string]bool{}
+
+	return dague, nil
+}
+
+// applyProfile merges the section of the profile, then its file, over the configuration. The profiles section is
+// removed from the configuration.
+func applyProfile(tree interface{}, profile string, profileSrc *source) (interface{}, error) {
+	root, ok := tree.(mapping)
+	if !ok {
+		return tree, nil
+	}
+	profiles, _ := root["profiles"].(mapping)
+	delete(root, "profiles")
+	if profile == "" {
+		return tree, nil
+	}
+
+	section, found := profiles[profile]
+	if found {
+		if s, ok := section.(mapping); ok && s["profiles"] != nil {
+			return nil, fmt.Errorf("profile %q can't define profiles", profile)
 		}
+		merged, err := merge(tree, section, false)
 		if err != nil {
-			return Dague{}, err
+			return nil, err
 		}
-		vars[k] = res
+		tree = merged
 	}
-	dague.Vars = vars
-
-	// post step to expand mount path for the base image
-	mounts := map[string]string{}
-	for k, v := range dague.Go.Image.Mounts {
-		expandedK, err := shell.Expand(k, dague.Vars)
+	if profileSrc != nil {
+		overlay, _, err := decode(profileSrc.data, false)
 		if err != nil {
-			return Dague{}, err
+			return nil, fmt.Errorf("could not parse %s profile file: %w", profileSrc.file, err)
+		}
+		merged, err := merge(tree, overlay, false)
+		if err != nil {
+			return nil, err
 		}
-		mounts[expandedK] = v
+		tree = merged
+		found = true
 	}
-	dague.Go.Image.Mounts = mounts
+	if !found {
+		return nil, fmt.Errorf("unknown profile %q, define it in the profiles section or in a .dague.%s.yml file", profile, profile)
+	}
+	return tree, nil
+}
 
-	return dague, nil
+// Var returns the value of the variable, resolving the variables it references first. The value is computed once.
+func (d *Dague) Var(name string) (string, error) {
+	r := d.resolver()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, _, err := r.get(name)
+	return v, err
 }
 
-func (d *Dague) VarsDup() map[string]string {
+// SetVar overrides the value of the variable for the rest of the run.
+func (d *Dague) SetVar(name, value string) {
+	r := d.resolver()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[name] = value
+}
+
+// Expand renders the Go template and expands the variables referenced in s, resolving only those.
+func (d *Dague) Expand(s string) (string, error) {
+	r := d.resolver()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.expand(s)
+}
+
+// Template renders the Go template of the shell script, its variables are expanded when it runs.
+func (d *Dague) Template(script string) (string, error) {
+	r := d.resolver()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.template(script)
+}
+
+// ScriptVars resolves the variables referenced by the shell script, to run it.
+func (d *Dague) ScriptVars(script string) (map[string]string, error) {
+	refs, err := shell.ScriptVars(script)
+	if err != nil {
+		return nil, err
+	}
+	r := d.resolver()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	vars := map[string]string{}
+	for _, ref := range refs {
+		v, ok, err := r.get(ref)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			vars[ref] = v
+		}
+	}
+	return vars, nil
+}
+
+// ReferencedVars resolves the variables referenced by the values, in their Go template and as shell variables, and the
+// named variables. A value starting with "shell " is a script, the variables it uses are resolved too.
+func (d *Dague) ReferencedVars(values []string, names ...string) (map[string]string, error) {
+	for _, v := range values {
+		refs, err := references(strings.TrimPrefix(v, "shell "), strings.HasPrefix(v, "shell "), true)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, refs...)
+	}
+	r := d.resolver()
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	vars := map[string]string{}
-	for k, v := range d.Vars {
-		vars[k] = v
+	for _, name := range names {
+		v, ok, err := r.get(name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			vars[name] = v
+		}
+	}
+	return vars, nil
+}
+
+func (d *Dague) resolver() *resolver {
+	if d.vars == nil {
+		d.vars = newResolver(context.Background(), d.Vars, nil, nil)
 	}
-	return vars
+	return d.vars
 }
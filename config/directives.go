@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Merge directives are YAML tags changing how a sequence is merged with the one it overrides.
+const (
+	appendTag  = "!append"
+	prependTag = "!prepend"
+)
+
+// directive is a sequence to append or prepend to the lower-priority one, instead of replacing it.
+type directive struct {
+	tag   string
+	items sequence
+}
+
+// withDirectives parses the source again, as yaml.v2 ignores custom tags, and replaces the sequences tagged with
+// a merge directive by a directive.
+func withDirectives(source []byte, contents interface{}) (interface{}, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(source, &node); err != nil {
+		return nil, fmt.Errorf("couldn't decode source: %v", err)
+	}
+	return markDirectives(resolve(&node), contents)
+}
+
+func markDirectives(n *yaml.Node, v interface{}) (interface{}, error) {
+	if n == nil {
+		return v, nil
+	}
+	switch n.Tag {
+	case appendTag, prependTag:
+		items, ok := v.(sequence)
+		if !ok {
+			return nil, fmt.Errorf("line %d: %s can only be used on a sequence", n.Line, n.Tag)
+		}
+		marked, err := markDirectives(&yaml.Node{Kind: yaml.SequenceNode, Content: n.Content}, items)
+		if err != nil {
+			return nil, err
+		}
+		return directive{tag: n.Tag, items: marked.(sequence)}, nil
+	}
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		m, ok := v.(mapping)
+		if !ok {
+			return v, nil
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k := n.Content[i]
+			if k.Tag == "!!merge" {
+				continue
+			}
+			for key, value := range m {
+				if fmt.Sprint(key) != k.Value {
+					continue
+				}
+				marked, err := markDirectives(n.Content[i+1], value)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = marked
+			}
+		}
+	case yaml.SequenceNode:
+		s, ok := v.(sequence)
+		if !ok {
+			return v, nil
+		}
+		for i := range s {
+			if i >= len(n.Content) {
+				break
+			}
+			marked, err := markDirectives(n.Content[i], s[i])
+			if err != nil {
+				return nil, err
+			}
+			s[i] = marked
+		}
+	}
+	return v, nil
+}
+
+// mergeDirective applies the directive to the lower-priority value.
+func mergeDirective(into interface{}, from directive, strict bool) (interface{}, error) {
+	if into == nil {
+		return from.items, nil
+	}
+	tag := ""
+	if d, ok := into.(directive); ok {
+		// both are directives, keep the lower-priority one to apply it later, for instance with extends
+		tag, into = d.tag, d.items
+	}
+	items, ok := into.(sequence)
+	if !ok {
+		if strict {
+			return nil, fmt.Errorf("can't %s a sequence to a %s", from.tag[1:], describe(into))
+		}
+		return from.items, nil
+	}
+	merged := make(sequence, 0, len(items)+len(from.items))
+	if from.tag == appendTag {
+		merged = append(append(merged, items...), from.items...)
+	} else {
+		merged = append(append(merged, from.items...), items...)
+	}
+	if tag != "" {
+		return directive{tag: tag, items: merged}, nil
+	}
+	return merged, nil
+}
+
+// clean replaces the remaining directives, that had nothing to merge with, by their sequence.
+func clean(v interface{}) interface{} {
+	switch value := v.(type) {
+	case directive:
+		return clean(value.items)
+	case mapping:
+		for k, item := range value {
+			value[k] = clean(item)
+		}
+	case sequence:
+		for i, item := range value {
+			value[i] = clean(item)
+		}
+	}
+	return v
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDirectives(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		strict bool
+		caches []Cache
+		err    string
+	}{
+		{
+			name:   "append",
+			config: "go:\n  image:\n    caches: !append\n      - target: /cache/lint\n",
+			strict: true,
+			caches: []Cache{{Target: "/cache/go"}, {Target: "/go/pkg"}, {Target: "/cache/lint"}},
+		},
+		{
+			name:   "prepend",
+			config: "go:\n  image:\n    caches: !prepend\n      - target: /cache/lint\n",
+			strict: true,
+			caches: []Cache{{Target: "/cache/lint"}, {Target: "/cache/go"}, {Target: "/go/pkg"}},
+		},
+		{
+			name:   "on a mapping",
+			config: "go:\n  image:\n    env: !append\n      CGO_ENABLED: \"0\"\n",
+			strict: true,
+			err:    "could not merge .dague.yml with defaults: line 3: !append can only be used on a sequence",
+		},
+		{
+			name:   "on a scalar",
+			config: "go:\n  image:\n    src: !prepend golang:1.20\n",
+			strict: false,
+			err:    "could not merge .dague.yml with defaults: line 3: !prepend can only be used on a sequence",
+		},
+		{
+			name:   "over a scalar",
+			config: "go:\n  image:\n    src: !append\n      - golang:1.20\n",
+			strict: true,
+			err:    "could not merge .dague.yml with defaults: can't append a sequence to a scalar",
+		},
+		{
+			name:   "over a mapping",
+			config: "go:\n  image:\n    env: !prepend\n      - CGO_ENABLED=0\n",
+			strict: true,
+			err:    "could not merge .dague.yml with defaults: can't prepend a sequence to a mapping",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _, err := load(t, tt.config, tt.strict)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(d.Go.Image.Caches, tt.caches) {
+				t.Errorf("expected caches %v, got %v", tt.caches, d.Go.Image.Caches)
+			}
+		})
+	}
+}
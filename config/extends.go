@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// extendable are the paths of the entries that can inherit from another entry of the same map using extends.
+var extendable = [][]string{
+	{"go", "build", "targets"},
+	{"go", "exec"},
+	{"tasks"},
+}
+
+// resolveExtends replaces each entry having an extends field with the entry it extends, deep-merged with its own
+// values. Entries can extend entries that extend others.
+func resolveExtends(tree interface{}, sources sources) error {
+	var problems Problems
+	for _, path := range extendable {
+		entries, ok := lookupMapping(tree, path)
+		if !ok {
+			continue
+		}
+		var names []string
+		for name := range entries {
+			names = append(names, fmt.Sprint(name))
+		}
+		sort.Strings(names)
+		resolved := mapping{}
+		for _, name := range names {
+			if err := resolveEntry(entries, resolved, name, path, nil, sources); err != nil {
+				if p, ok := err.(Problems); ok {
+					problems = append(problems, p...)
+					continue
+				}
+				return err
+			}
+		}
+		for name, entry := range resolved {
+			entries[name] = entry
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+func resolveEntry(entries, resolved mapping, name string, path, stack []string, sources sources) error {
+	if _, ok := resolved[name]; ok {
+		return nil
+	}
+	entryPath := append(toPath(path), name, "extends")
+	for _, n := range stack {
+		if n == name {
+			return Problems{sources.problem(entryPath, "extends cycle: %s -> %s", strings.Join(stack, " -> "), name)}
+		}
+	}
+
+	entry, ok := entries[name].(mapping)
+	if !ok {
+		resolved[name] = entries[name]
+		return nil
+	}
+	parent, ok := entry["extends"]
+	if !ok {
+		resolved[name] = entry
+		return nil
+	}
+	parentName := fmt.Sprint(parent)
+	if _, ok := entries[parentName]; !ok {
+		return Problems{sources.problem(entryPath, "%q extends %q which does not exist in %s", name, parentName, strings.Join(path, "."))}
+	}
+	if err := resolveEntry(entries, resolved, parentName, path, append(stack, name), sources); err != nil {
+		return err
+	}
+	merged, err := merge(resolved[parentName], entry, false)
+	if err != nil {
+		return err
+	}
+	// an entry extending an abstract one can be run, unless abstract too
+	if m, ok := merged.(mapping); ok {
+		delete(m, "abstract")
+		if abstract, ok := entry["abstract"]; ok {
+			m["abstract"] = abstract
+		}
+	}
+	resolved[name] = merged
+	return nil
+}
+
+// TargetNames returns the sorted names of the targets that can be built, without the abstract ones.
+func (d *Dague) TargetNames() []string {
+	var names []string
+	for name, target := range d.Go.Build.Targets {
+		if !target.Abstract {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExecNames returns the sorted names of the exec that can be run, without the abstract ones.
+func (d *Dague) ExecNames() []string {
+	var names []string
+	for name, exec := range d.Go.Exec {
+		if !exec.Abstract {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TaskNames returns the sorted names of the tasks that can be run, without the abstract ones.
+func (d *Dague) TaskNames() []string {
+	var names []string
+	for name, task := range d.Tasks {
+		if !task.Abstract {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupMapping(tree interface{}, path []string) (mapping, bool) {
+	for _, key := range path {
+		m, ok := tree.(mapping)
+		if !ok {
+			return nil, false
+		}
+		tree = m[key]
+	}
+	m, ok := tree.(mapping)
+	return m, ok
+}
+
+func toPath(keys []string) []interface{} {
+	path := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		path = append(path, k)
+	}
+	return path
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtendsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+		next   string
+	}{
+		{
+			name:   "cycle, reported for each entry",
+			config: "tasks:\n  a:\n    extends: b\n  b:\n    extends: a\n",
+			err:    `:3:14: extends cycle: a -> b -> a`,
+			next:   `:5:14: extends cycle: b -> a -> b`,
+		},
+		{
+			name:   "self",
+			config: "go:\n  exec:\n    a:\n      extends: a\n",
+			err:    `:4:16: extends cycle: a -> a`,
+		},
+		{
+			name:   "missing parent",
+			config: "go:\n  build:\n    targets:\n      cli:\n        extends: base\n",
+			err:    `:5:18: "cli" extends "base" which does not exist in go.build.targets`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, file, err := load(t, tt.config, false)
+			want := file + tt.err
+			if tt.next != "" {
+				want += "\n" + file + tt.next
+			}
+			if err == nil || err.Error() != want {
+				t.Fatalf("expected error %q, got %v", want, err)
+			}
+		})
+	}
+}
+
+func TestExtendsAbstract(t *testing.T) {
+	d, _, err := load(t, `tasks:
+  base:
+    abstract: true
+    deps: [go:fmt]
+    cmds: make
+  build:
+    extends: base
+  template:
+    extends: base
+    abstract: true
+    cmds: make all
+  release:
+    extends: template
+`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		abstract bool
+		cmds     string
+	}{
+		{name: "base", abstract: true, cmds: "make"},
+		{name: "build", abstract: false, cmds: "make"},
+		{name: "template", abstract: true, cmds: "make all"},
+		{name: "release", abstract: false, cmds: "make all"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := d.Tasks[tt.name]
+			if task.Abstract != tt.abstract {
+				t.Errorf("expected abstract to be %v, got %v", tt.abstract, task.Abstract)
+			}
+			if task.Cmds != tt.cmds {
+				t.Errorf("expected cmds %q, got %q", tt.cmds, task.Cmds)
+			}
+			if !reflect.DeepEqual(task.Deps, []string{"go:fmt"}) {
+				t.Errorf("expected the deps to be inherited, got %v", task.Deps)
+			}
+		})
+	}
+	if names := d.TaskNames(); !reflect.DeepEqual(names, []string{"build", "release"}) {
+		t.Errorf("expected only the concrete tasks, got %v", names)
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadIncludes reads the files included by the source, recursively, in merge order: the includes of an included file
+// come before it. Paths are relative to the directory of the including file. The stack is the list of the files being
+// included, to detect cycles.
+func loadIncludes(src *source, stack []string) ([]*source, error) {
+	abs, err := filepath.Abs(src.file)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range stack {
+		if f == abs {
+			return nil, fmt.Errorf("include cycle: %s -> %s", strings.Join(stack, " -> "), abs)
+		}
+	}
+	stack = append(stack, abs)
+
+	includes := mappingValue(resolve(src.node), "include")
+	if includes == nil {
+		return nil, nil
+	}
+	if includes = resolve(includes); includes.Kind != yaml.SequenceNode {
+		return nil, Problems{src.problem([]interface{}{"include"}, "include must be a list of files")}
+	}
+
+	var sources []*source
+	for i, inc := range includes.Content {
+		file := filepath.Join(filepath.Dir(src.file), inc.Value)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, Problems{src.problem([]interface{}{"include", i}, "could not read included file: %s", err)}
+		}
+		included, err := parseSource(file, data)
+		if err != nil {
+			return nil, err
+		}
+		nested, err := loadIncludes(included, stack)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, nested...)
+		sources = append(sources, included)
+	}
+	return sources, nil
+}
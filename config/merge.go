@@ -48,47 +48,77 @@ type (
 //	{"foo": [1, 2, 3]} + {"foo": [4, 5, 6]}
 //	== {"foo": [4, 5, 6]}
 //
+// Unless tagged with the !append or !prepend merge directives. For example,
+//
+//	{"foo": [1, 2, 3]} + {"foo": !append [4, 5, 6]}
+//	== {"foo": [1, 2, 3, 4, 5, 6]}
+//
 // In non-strict mode, duplicate map keys are allowed within a single source,
 // with later values overwriting previous ones. Attempting to merge
 // mismatched types (e.g., merging a sequence into a map) replaces the old
 // value with the new.
 //
-// Enabling strict mode returns errors in both of the above cases.
+// Enabling strict mode returns errors in both of the above cases, and when
+// a merge directive is applied to a mapping or a scalar.
 func YAML(sources [][]byte, strict bool) (*bytes.Buffer, error) {
+	merged, hasContent, err := mergeSources(sources, strict)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if !hasContent {
+		// No sources had any content. To distinguish this from a source with just
+		// an explicit top-level null, return an empty buffer.
+		return buf, nil
+	}
+	enc := yaml.NewEncoder(buf)
+	if err := enc.Encode(clean(merged)); err != nil {
+		return nil, fmt.Errorf("couldn't re-serialize merged YAML: %v", err)
+	}
+	return buf, nil
+}
+
+// mergeSources deep-merges the sources like YAML, but returns the merged
+// value with the merge directives not applied yet, to be merged again.
+func mergeSources(sources [][]byte, strict bool) (interface{}, bool, error) {
 	var merged interface{}
 	var hasContent bool
 	for _, r := range sources {
-		d := yaml.NewDecoder(bytes.NewReader(r))
-		d.SetStrict(strict)
-
-		var contents interface{}
-		if err := d.Decode(&contents); err == io.EOF {
+		contents, ok, err := decode(r, strict)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
 			// Skip empty and comment-only sources, which we should handle
 			// differently from explicit nils.
 			continue
-		} else if err != nil {
-			return nil, fmt.Errorf("couldn't decode source: %v", err)
 		}
 
 		hasContent = true
 		pair, err := merge(merged, contents, strict)
 		if err != nil {
-			return nil, err // error is already descriptive enough
+			return nil, false, err // error is already descriptive enough
 		}
 		merged = pair
 	}
+	return merged, hasContent, nil
+}
 
-	buf := &bytes.Buffer{}
-	if !hasContent {
-		// No sources had any content. To distinguish this from a source with just
-		// an explicit top-level null, return an empty buffer.
-		return buf, nil
-	}
-	enc := yaml.NewEncoder(buf)
-	if err := enc.Encode(merged); err != nil {
-		return nil, fmt.Errorf("couldn't re-serialize merged YAML: %v", err)
+// decode decodes a source with its merge directives. It returns false for
+// empty and comment-only sources.
+func decode(source []byte, strict bool) (interface{}, bool, error) {
+	d := yaml.NewDecoder(bytes.NewReader(source))
+	d.SetStrict(strict)
+
+	var contents interface{}
+	if err := d.Decode(&contents); err == io.EOF {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("couldn't decode source: %v", err)
 	}
-	return buf, nil
+	contents, err := withDirectives(source, contents)
+	return contents, err == nil, err
 }
 
 func merge(into, from interface{}, strict bool) (interface{}, error) {
@@ -103,6 +133,12 @@ func merge(into, from interface{}, strict bool) (interface{}, error) {
 		// Allow higher-priority YAML to explicitly nil out lower-priority entries.
 		return nil, nil
 	}
+	if d, ok := from.(directive); ok {
+		return mergeDirective(into, d, strict)
+	}
+	if d, ok := into.(directive); ok {
+		into = d.items
+	}
 	if IsScalar(into) && IsScalar(from) {
 		return from, nil
 	}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Schema returns the JSON Schema of the configuration file. It is generated from the configuration types, with the
+// desc and enum tags of the fields, and the values of the default configuration.
+func Schema() ([]byte, error) {
+	var defaultValues interface{}
+	if err := yaml.Unmarshal(defaults, &defaultValues); err != nil {
+		return nil, fmt.Errorf("could not parse default configuration: %w", err)
+	}
+
+	schema := typeSchema(reflect.TypeOf(Dague{}), jsonValue(defaultValues))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "dague configuration"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// typeSchema returns the schema of the type, def being the default value if any.
+func typeSchema(t reflect.Type, def interface{}) map[string]interface{} {
+	schema := map[string]interface{}{}
+	switch t.Kind() {
+	case reflect.Struct:
+		defs, _ := def.(map[string]interface{})
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			property := typeSchema(f.Type, defs[name])
+			if desc := f.Tag.Get("desc"); desc != "" {
+				property["description"] = desc
+			}
+			if enum := f.Tag.Get("enum"); enum != "" {
+				property["enum"] = strings.Split(enum, ",")
+			}
+			properties[name] = property
+		}
+		schema["type"] = "object"
+		schema["properties"] = properties
+		schema["additionalProperties"] = false
+		return schema
+	case reflect.Map:
+		schema["type"] = "object"
+		if t.Elem() == reflect.TypeOf(Dague{}) {
+			// profiles are configurations themselves
+			schema["additionalProperties"] = map[string]interface{}{"$ref": "#"}
+			return schema
+		}
+		// values of maps are often environment variables, written as numbers or booleans like CGO_ENABLED: 0
+		if t.Elem().Kind() == reflect.String {
+			schema["additionalProperties"] = map[string]interface{}{"type": []string{"string", "number", "boolean"}}
+		} else {
+			schema["additionalProperties"] = typeSchema(t.Elem(), nil)
+		}
+	case reflect.Slice:
+		schema["type"] = "array"
+		schema["items"] = typeSchema(t.Elem(), nil)
+	case reflect.String:
+		schema["type"] = "string"
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	}
+	if def != nil {
+		schema["default"] = def
+	}
+	return schema
+}
+
+// jsonValue converts a value decoded from YAML to a value that can be encoded as JSON.
+func jsonValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range value {
+			m[fmt.Sprint(k)] = jsonValue(v)
+		}
+		return m
+	case []interface{}:
+		for i, v := range value {
+			value[i] = jsonValue(v)
+		}
+	}
+	return v
+}
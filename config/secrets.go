@@ -0,0 +1,88 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/eunomie/dague/internal/shell"
+)
+
+// check reports a secret without source, or with several ones.
+func (s Secret) check() error {
+	n := 0
+	for _, source := range []string{s.Env, s.File, s.Cmd} {
+		if source != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New("exactly one of env, file or cmd must be set")
+	}
+	return nil
+}
+
+// SecretValues returns the values of the named secrets, read from the host environment variables, files or scripts.
+// Each secret is read once per run, only when requested.
+func (d *Dague) SecretValues(ctx context.Context, names ...string) (map[string]string, error) {
+	if len(names) == 0 {
+		return map[string]string{}, nil
+	}
+	if err := d.RenderSection("secrets"); err != nil {
+		return nil, err
+	}
+
+	r := d.resolver()
+	secrets := map[string]string{}
+	for _, name := range names {
+		r.mu.Lock()
+		value, ok := r.secrets[name]
+		r.mu.Unlock()
+		if !ok {
+			var err error
+			if value, err = d.secretValue(ctx, name); err != nil {
+				return nil, fmt.Errorf("secret %q: %w", name, err)
+			}
+			r.mu.Lock()
+			if r.secrets == nil {
+				r.secrets = map[string]string{}
+			}
+			r.secrets[name] = value
+			r.mu.Unlock()
+		}
+		secrets[name] = value
+	}
+	return secrets, nil
+}
+
+// secretValue reads the value of a secret from its source.
+func (d *Dague) secretValue(ctx context.Context, name string) (string, error) {
+	secret, ok := d.Secrets[name]
+	if !ok {
+		return "", errors.New("unknown secret")
+	}
+	if err := secret.check(); err != nil {
+		return "", err
+	}
+	switch {
+	case secret.Env != "":
+		v, ok := os.LookupEnv(secret.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", secret.Env)
+		}
+		return v, nil
+	case secret.File != "":
+		data, err := os.ReadFile(secret.File)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	default:
+		vars, err := d.ScriptVars(secret.Cmd)
+		if err != nil {
+			return "", err
+		}
+		return shell.Interpret(ctx, secret.Cmd, vars)
+	}
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecretValuesOnlyRequested(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	t.Setenv("DAGUE_TEST_TOKEN", "token")
+	d := Dague{Secrets: map[string]Secret{
+		"TOKEN":  {Env: "DAGUE_TEST_TOKEN"},
+		"UNUSED": {Cmd: "touch " + marker},
+	}}
+
+	secrets, err := d.SecretValues(context.Background(), "TOKEN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 1 || secrets["TOKEN"] != "token" {
+		t.Errorf("expected only the TOKEN secret, got %v", secrets)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("the cmd of the UNUSED secret must not be run")
+	}
+	if _, err := d.SecretValues(context.Background(), "MISSING"); err == nil {
+		t.Error("expected an error for an unknown secret")
+	}
+}
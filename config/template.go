@@ -0,0 +1,364 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/eunomie/dague/internal/semver"
+	"github.com/eunomie/dague/internal/shell"
+)
+
+// Modes of the expansion of a field, set with the expand struct tag.
+const (
+	// expandSkip fields are not expanded.
+	expandSkip = "-"
+	// expandScript fields are shell scripts: only the Go template is rendered with the section, the variables are
+	// given to the script when it runs.
+	expandScript = "script"
+	// expandBuild fields are expanded for each build, as they can use the environment variables of the target.
+	expandBuild = "build"
+	// expandLazy fields are not rendered with their section, but by the commands using them, like the entry of the
+	// target to build.
+	expandLazy = "lazy"
+)
+
+// funcs are the helpers available in the Go templates of the configuration.
+var funcs = template.FuncMap{
+	// default returns the value, or def if the value is empty.
+	"default": func(def, value string) string {
+		if value == "" {
+			return def
+		}
+		return value
+	},
+	"env":    os.Getenv,
+	"os":     func() string { return runtime.GOOS },
+	"arch":   func() string { return runtime.GOARCH },
+	"semver": semver.Parse,
+}
+
+// Render renders the Go template then expands the shell variables of s, using vars. Referencing an undefined variable
+// is an error.
+func Render(s string, vars map[string]string) (string, error) {
+	res, err := RenderTemplate(s, vars)
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(res, "$") {
+		return res, nil
+	}
+	return shell.ExpandStrict(res, vars)
+}
+
+// RenderTemplate renders the Go template of s, with the variables as fields. Referencing an undefined variable is an
+// error, unless it is given to default, like {{ .VERSION | default "dev" }}.
+func RenderTemplate(s string, vars map[string]string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	tmpl, err := template.New("").Funcs(funcs).Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
+	}
+	names, required := templateFields(tmpl)
+	data := make(map[string]string, len(vars))
+	for k, v := range vars {
+		data[k] = v
+	}
+	for _, name := range names {
+		if _, ok := vars[name]; ok {
+			continue
+		}
+		if required[name] {
+			return "", fmt.Errorf("undefined variable %s", name)
+		}
+		data[name] = ""
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// references returns the names of the variables used by s, in its Go template and as shell variables. For a script,
+// only the variables of the Go template are returned, unless withScript is set.
+func references(s string, script, withScript bool) ([]string, error) {
+	var refs []string
+	if strings.Contains(s, "{{") {
+		tmpl, err := template.New("").Funcs(funcs).Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		refs, _ = templateFields(tmpl)
+	}
+	var names []string
+	var err error
+	switch {
+	case !strings.Contains(s, "$"):
+	case !script:
+		names, err = shell.Vars(s)
+	case withScript:
+		names, err = shell.ScriptVars(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(refs, names...), nil
+}
+
+// templateFields returns the names of the fields used in the template, like VERSION for {{ .VERSION }}, and the ones
+// that must be defined. A field given to default, as an argument or piped into it, can be undefined.
+func templateFields(tmpl *template.Template) ([]string, map[string]bool) {
+	var names []string
+	seen := map[string]bool{}
+	required := map[string]bool{}
+	var walk func(n parse.Node, optional bool)
+	walk = func(n parse.Node, optional bool) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c, false)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe, false)
+		case *parse.IfNode:
+			walk(n.Pipe, false)
+			walk(n.List, false)
+			walk(n.ElseList, false)
+		case *parse.RangeNode:
+			walk(n.Pipe, false)
+			walk(n.List, false)
+			walk(n.ElseList, false)
+		case *parse.WithNode:
+			walk(n.Pipe, false)
+			walk(n.List, false)
+			walk(n.ElseList, false)
+		case *parse.TemplateNode:
+			walk(n.Pipe, false)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for i, c := range n.Cmds {
+				// {{ .VERSION | default "dev" }}
+				piped := i+1 < len(n.Cmds) && isDefault(n.Cmds[i+1]) && len(c.Args) == 1
+				walk(c, optional || piped)
+			}
+		case *parse.CommandNode:
+			if isDefault(n) {
+				// {{ default "dev" .VERSION }}
+				for _, a := range n.Args[1:] {
+					walk(a, true)
+				}
+				return
+			}
+			for _, a := range n.Args {
+				walk(a, optional && len(n.Args) == 1)
+			}
+		case *parse.ChainNode:
+			walk(n.Node, false)
+		case *parse.FieldNode:
+			name := n.Ident[0]
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+			if !optional {
+				required[name] = true
+			}
+		}
+	}
+	if tmpl.Tree != nil {
+		walk(tmpl.Tree.Root, false)
+	}
+	return names, required
+}
+
+// isDefault reports whether the command calls the default helper.
+func isDefault(cmd *parse.CommandNode) bool {
+	if len(cmd.Args) == 0 {
+		return false
+	}
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	return ok && ident.Ident == "default"
+}
+
+// RenderSection expands the variables and renders the Go templates of the string fields of a section of the
+// configuration, given by its path like go, image. The lazy fields it contains, like the targets or the tasks, are left
+// for the commands using them. A section is only rendered once, and each problem is reported with the position of the
+// field. RenderSection is not safe for concurrent use.
+func (d *Dague) RenderSection(path ...string) error {
+	return d.renderPath(path, false)
+}
+
+// RenderAll expands the variables and renders the Go templates of every string field of the configuration, including
+// the lazy ones, to report all the problems at once.
+func (d *Dague) RenderAll() error {
+	return d.renderPath(nil, true)
+}
+
+func (d *Dague) renderPath(path []string, all bool) error {
+	if d.rendered == nil {
+		d.rendered = map[string]bool{}
+	}
+	var problems Problems
+	if err := d.renderValue(reflect.ValueOf(d).Elem(), nil, path, "", d.enter(coverage{}, nil, false), all, &problems); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// coverage tells if a value is part of a section already rendered, with or without its lazy fields.
+type coverage struct {
+	section bool
+	all     bool
+}
+
+// enter returns the coverage of the value at path, and of its lazy fields if lazy is set.
+func (d *Dague) enter(c coverage, path []interface{}, lazy bool) coverage {
+	if lazy {
+		c.section = c.all
+	}
+	if all, ok := d.rendered[renderKey(path)]; ok {
+		c.section = true
+		c.all = c.all || all
+	}
+	return c
+}
+
+// renderValue renders the value at path, after looking up the value of the remaining path elements, rest. With all,
+// the lazy fields are rendered too.
+func (d *Dague) renderValue(v reflect.Value, path []interface{}, rest []string, mode string, c coverage, all bool, problems *Problems) error {
+	if len(rest) == 0 {
+		d.renderTree(v, path, mode, c, all, problems)
+		key := renderKey(path)
+		d.rendered[key] = d.rendered[key] || all
+		return nil
+	}
+
+	child := append(path[:len(path):len(path)], rest[0])
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() || strings.Split(f.Tag.Get("yaml"), ",")[0] != rest[0] {
+				continue
+			}
+			fieldMode := f.Tag.Get("expand")
+			if fieldMode == expandSkip || fieldMode == expandBuild {
+				return nil
+			}
+			return d.renderValue(v.Field(i), child, rest[1:], fieldMode, d.enter(c, child, fieldMode == expandLazy), all, problems)
+		}
+	case reflect.Map:
+		k := reflect.ValueOf(rest[0]).Convert(v.Type().Key())
+		elem := v.MapIndex(k)
+		if !elem.IsValid() {
+			// missing entries are reported by the commands
+			return nil
+		}
+		value := reflect.New(v.Type().Elem()).Elem()
+		value.Set(elem)
+		if err := d.renderValue(value, child, rest[1:], mode, d.enter(c, child, false), all, problems); err != nil {
+			return err
+		}
+		v.SetMapIndex(k, value)
+		return nil
+	}
+	return fmt.Errorf("unknown configuration section %s", dotted(child))
+}
+
+// renderTree renders the strings of the value not already rendered. The lazy fields are skipped, unless all is set.
+func (d *Dague) renderTree(v reflect.Value, path []interface{}, mode string, c coverage, all bool, problems *Problems) {
+	renderString := func(s string, path []interface{}) string {
+		var res string
+		var err error
+		if mode == expandScript {
+			res, err = d.Template(s)
+		} else {
+			res, err = d.Expand(s)
+		}
+		if err != nil {
+			*problems = append(*problems, d.sources.problem(path, "%s: %s", dotted(path), err))
+			return s
+		}
+		return res
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if !c.section {
+			v.SetString(renderString(v.String(), path))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fieldMode := f.Tag.Get("expand")
+			lazy := fieldMode == expandLazy
+			if !f.IsExported() || fieldMode == expandSkip || fieldMode == expandBuild || (lazy && !all) {
+				continue
+			}
+			fieldPath := append(path[:len(path):len(path)], strings.Split(f.Tag.Get("yaml"), ",")[0])
+			d.renderTree(v.Field(i), fieldPath, fieldMode, d.enter(c, fieldPath, lazy), all, problems)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			d.renderTree(v.Index(i), append(path[:len(path):len(path)], i), mode, c, all, problems)
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		var keys []string
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		rendered := reflect.MakeMapWithSize(v.Type(), len(keys))
+		for _, k := range keys {
+			keyPath := append(path[:len(path):len(path)], k)
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key())))
+			d.renderTree(value, keyPath, mode, d.enter(c, keyPath, false), all, problems)
+			key := k
+			if v.Type().Elem().Kind() == reflect.String && !c.section {
+				key = renderString(k, keyPath)
+			}
+			rendered.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), value)
+		}
+		v.Set(rendered)
+	}
+}
+
+// renderKey identifies a rendered section by its path.
+func renderKey(path []interface{}) string {
+	var keys []string
+	for _, k := range path {
+		keys = append(keys, fmt.Sprint(k))
+	}
+	return strings.Join(keys, "\x00")
+}
+
+func dotted(path []interface{}) string {
+	var keys []string
+	for _, k := range path {
+		keys = append(keys, fmt.Sprint(k))
+	}
+	return strings.Join(keys, ".")
+}
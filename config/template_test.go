@@ -0,0 +1,113 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	vars := map[string]string{
+		"VERSION": "1.2.3",
+		"EMPTY":   "",
+	}
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		err      string
+	}{
+		{name: "no template", template: "plain", want: "plain"},
+		{name: "defined", template: "v{{ .VERSION }}", want: "v1.2.3"},
+		{name: "undefined", template: "v{{ .MISSING }}", err: "undefined variable MISSING"},
+		{name: "piped into default, undefined", template: `{{ .MISSING | default "dev" }}`, want: "dev"},
+		{name: "default argument, undefined", template: `{{ default "dev" .MISSING }}`, want: "dev"},
+		{name: "piped into default, empty", template: `{{ .EMPTY | default "dev" }}`, want: "dev"},
+		{name: "piped into default, defined", template: `{{ .VERSION | default "dev" }}`, want: "1.2.3"},
+		{name: "default in parentheses", template: `v{{ (default "dev" .MISSING) }}`, want: "vdev"},
+		{name: "undefined outside default", template: `{{ .MISSING | default "dev" }}-{{ .MISSING }}`, err: "undefined variable MISSING"},
+		{name: "undefined before another function", template: `{{ .MISSING | printf "%s" | default "dev" }}`, err: "undefined variable MISSING"},
+		{name: "undefined in condition", template: `{{ if .MISSING }}x{{ end }}`, err: "undefined variable MISSING"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderTemplate(tt.template, vars)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %q, %v", tt.err, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRenderUnsetVariable(t *testing.T) {
+	d := Dague{Vars: map[string]string{
+		"CHANNEL": `{{ .RELEASE_CHANNEL | default "stable" }}`,
+		"SUFFIX":  "${RELEASE_SUFFIX:-}",
+	}}
+	channel, err := d.Var("CHANNEL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel != "stable" {
+		t.Errorf("expected stable, got %q", channel)
+	}
+	suffix, err := d.Var("SUFFIX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suffix != "" {
+		t.Errorf("expected an empty suffix, got %q", suffix)
+	}
+	if _, err := d.Expand("{{ .RELEASE_CHANNEL }}"); err == nil {
+		t.Error("expected an error for an undefined variable outside default")
+	}
+}
+
+func TestRenderSection(t *testing.T) {
+	d := Dague{
+		Vars: map[string]string{
+			"IMAGE": "shell echo golang",
+			"TASK":  "shell echo task",
+		},
+		Go: Go{
+			Image: Image{Src: "${IMAGE}", Env: map[string]string{"LITERAL": `{{ "{{ .TASK }}" }}`}},
+			Exec:  map[string]Exec{"print": {Cmds: "echo {{ .TASK }} $TASK"}},
+		},
+		Tasks: Tasks{"print": {Cmds: "echo {{ .TASK }}"}},
+	}
+	if err := d.RenderSection("go"); err != nil {
+		t.Fatal(err)
+	}
+	if d.Go.Image.Src != "golang" {
+		t.Errorf("expected the image to be rendered, got %q", d.Go.Image.Src)
+	}
+	if _, ok := d.resolver().values["TASK"]; ok {
+		t.Error("TASK must not be resolved before a task using it is rendered")
+	}
+	if d.Go.Exec["print"].Cmds != "echo {{ .TASK }} $TASK" {
+		t.Errorf("expected the exec to be left to go:exec, got %q", d.Go.Exec["print"].Cmds)
+	}
+
+	if err := d.RenderSection("go", "exec", "print"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RenderAll(); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Go.Image.Env["LITERAL"]; got != "{{ .TASK }}" {
+		t.Errorf("expected the image env to be rendered once, got %q", got)
+	}
+	if got := d.Go.Exec["print"].Cmds; got != "echo task $TASK" {
+		t.Errorf("expected the exec to be rendered once, got %q", got)
+	}
+	if got := d.Tasks["print"].Cmds; got != "echo task" {
+		t.Errorf("expected the task to be rendered by RenderAll, got %q", got)
+	}
+}
@@ -0,0 +1,448 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/eunomie/dague/types"
+)
+
+// Problem is an error in the configuration, located in the file.
+type Problem struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (p Problem) Error() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Line, p.Column, p.Message)
+}
+
+// Problems is the list of all the errors found in the configuration.
+type Problems []Problem
+
+func (p Problems) Error() string {
+	var msgs []string
+	for _, problem := range p {
+		msgs = append(msgs, problem.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// source is a parsed configuration file, kept to report the position of the problems.
+type source struct {
+	file string
+	data []byte
+	node *yaml.Node
+}
+
+func parseSource(file string, data []byte) (*source, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("could not parse %s config file: %w", file, err)
+	}
+	return &source{file: file, data: data, node: &node}, nil
+}
+
+// sources are the parsed configuration files, by priority: the configuration file then the included files in
+// reverse order.
+type sources []*source
+
+// problem creates a problem positioned in the first source defining the path, or at the closest node of the path in
+// the configuration file. Elements of the path are mapping keys or sequence indexes.
+func (s sources) problem(path []interface{}, format string, a ...interface{}) Problem {
+	for _, src := range s {
+		if n, complete := src.lookup(path); complete {
+			return Problem{File: src.file, Line: n.Line, Column: n.Column, Message: fmt.Sprintf(format, a...)}
+		}
+	}
+	if len(s) == 0 {
+		return Problem{Message: fmt.Sprintf(format, a...)}
+	}
+	return s[0].problem(path, format, a...)
+}
+
+// problem creates a problem positioned at the closest node of the path.
+func (s *source) problem(path []interface{}, format string, a ...interface{}) Problem {
+	p := Problem{File: s.file, Message: fmt.Sprintf(format, a...)}
+	if n, _ := s.lookup(path); n != nil {
+		p.Line, p.Column = n.Line, n.Column
+	}
+	return p
+}
+
+// lookup returns the node of the path, or the closest parent found and false. Keys brought by merge keys (<<) are
+// followed.
+func (s *source) lookup(path []interface{}) (*yaml.Node, bool) {
+	var found *yaml.Node
+	n := resolve(s.node)
+	for _, elem := range path {
+		var next *yaml.Node
+		switch e := elem.(type) {
+		case string:
+			next = mappingValue(n, e)
+		case int:
+			if n != nil && n.Kind == yaml.SequenceNode && e < len(n.Content) {
+				next = n.Content[e]
+			}
+		}
+		if next == nil {
+			return found, false
+		}
+		found, n = next, resolve(next)
+	}
+	return found, true
+}
+
+func resolve(n *yaml.Node) *yaml.Node {
+	for n != nil && (n.Kind == yaml.DocumentNode || n.Kind == yaml.AliasNode) {
+		if n.Kind == yaml.AliasNode {
+			n = n.Alias
+		} else if len(n.Content) > 0 {
+			n = n.Content[0]
+		} else {
+			return nil
+		}
+	}
+	return n
+}
+
+// mappingValue returns the value of the key in the mapping, looking into the merged mappings if not defined directly.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	var merged []*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Value == key {
+			return v
+		}
+		if k.Tag == "!!merge" {
+			if v = resolve(v); v != nil && v.Kind == yaml.SequenceNode {
+				merged = append(merged, v.Content...)
+			} else {
+				merged = append(merged, v)
+			}
+		}
+	}
+	for _, m := range merged {
+		if v := mappingValue(resolve(m), key); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// checkKeys reports the keys of the file not matching any field of the configuration, and the keys defined twice in
+// the same mapping. Keys brought by merge keys (<<) can be overridden.
+func (s *source) checkKeys() Problems {
+	return s.checkNodeKeys(resolve(s.node), reflect.TypeOf(Dague{}), nil)
+}
+
+// checkKeys reports the unknown and duplicated keys of all the files, see source.checkKeys.
+func (s sources) checkKeys() Problems {
+	var problems Problems
+	// in merge order: the included files, the configuration file, then the profile
+	for i := len(s) - 1; i >= 0; i-- {
+		problems = append(problems, s[i].checkKeys()...)
+	}
+	return problems
+}
+
+func (s *source) checkNodeKeys(n *yaml.Node, t reflect.Type, path []string) Problems {
+	// aliases are checked where the anchor is defined
+	if n == nil || n.Kind == yaml.AliasNode {
+		return nil
+	}
+	var problems Problems
+	if n.Kind == yaml.MappingNode {
+		seen := map[string]bool{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k := n.Content[i]
+			if k.Tag == "!!merge" {
+				continue
+			}
+			if seen[k.Value] {
+				problems = append(problems, Problem{
+					File:    s.file,
+					Line:    k.Line,
+					Column:  k.Column,
+					Message: fmt.Sprintf("key %q is already defined", k.Value),
+				})
+			}
+			seen[k.Value] = true
+		}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if name := strings.Split(f.Tag.Get("yaml"), ",")[0]; name != "" && name != "-" {
+				fields[name] = f.Type
+			}
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			if k.Tag == "!!merge" {
+				continue
+			}
+			ft, ok := fields[k.Value]
+			if !ok {
+				problems = append(problems, Problem{
+					File:    s.file,
+					Line:    k.Line,
+					Column:  k.Column,
+					Message: unknownField(k.Value, path, fields),
+				})
+				continue
+			}
+			problems = append(problems, s.checkNodeKeys(v, ft, append(path, k.Value))...)
+		}
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Tag == "!!merge" {
+				continue
+			}
+			problems = append(problems, s.checkNodeKeys(n.Content[i+1], t.Elem(), append(path, n.Content[i].Value))...)
+		}
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			return nil
+		}
+		for i, item := range n.Content {
+			problems = append(problems, s.checkNodeKeys(item, t.Elem(), append(path, fmt.Sprint(i)))...)
+		}
+	case reflect.Ptr:
+		return s.checkNodeKeys(n, t.Elem(), path)
+	}
+	return problems
+}
+
+func unknownField(key string, path []string, fields map[string]reflect.Type) string {
+	in := strings.Join(path, ".")
+	if in == "" {
+		in = "the root"
+	}
+	msg := fmt.Sprintf("unknown field %q in %s", key, in)
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if distance(strings.ToLower(key), strings.ToLower(name)) <= 2 {
+			return msg + fmt.Sprintf(", did you mean %q?", name)
+		}
+	}
+	return msg
+}
+
+// distance is the Levenshtein distance between the two strings.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// Validate checks the keys of the configuration files, renders the whole configuration and checks its semantic:
+// platforms, dependencies referencing existing commands and tasks, commands to run and exports. The commands are the
+// names of the available commands, like go:build.
+func (d *Dague) Validate(commands []string) error {
+	problems := d.sources.checkKeys()
+	if err := d.RenderAll(); err != nil {
+		var rendering Problems
+		if !errors.As(err, &rendering) {
+			return err
+		}
+		problems = append(problems, rendering...)
+	}
+	s := d.sources
+
+	for _, name := range sortedKeys(d.Go.Build.Targets) {
+		target := d.Go.Build.Targets[name]
+		path := []interface{}{"go", "build", "targets", name}
+		if target.Path == "" && !target.Abstract {
+			problems = append(problems, s.problem(path, "target %q has no path", name))
+		}
+		for i, p := range target.Platforms {
+			if _, err := types.ParsePlatform(p); err != nil {
+				problems = append(problems, s.problem(append(path, "platforms", i), "target %q: %s", name, err))
+			}
+		}
+		if target.Cgo.Enable {
+			if err := target.Cgo.Check(target.Platforms); err != nil {
+				problems = append(problems, s.problem(append(path, "cgo"), "target %q: %s", name, err))
+			}
+		}
+		problems = append(problems, d.validateSecrets(path, target.Secrets)...)
+	}
+
+	for _, name := range sortedKeys(d.Go.Exec) {
+		exec := d.Go.Exec[name]
+		path := []interface{}{"go", "exec", name}
+		if strings.TrimSpace(exec.Cmds) == "" && !exec.Abstract {
+			problems = append(problems, s.problem(path, "exec %q has no cmds", name))
+		}
+		if (exec.Export.Pattern == "") != (exec.Export.Path == "") {
+			problems = append(problems, s.problem(append(path, "export"), "exec %q: export needs both a pattern and a path", name))
+		}
+		problems = append(problems, d.validateSecrets(path, exec.Secrets)...)
+		problems = append(problems, d.validateDeps(path, exec.Deps, commands)...)
+	}
+
+	for _, name := range sortedKeys(d.Tasks) {
+		task := d.Tasks[name]
+		path := []interface{}{"tasks", name}
+		if strings.TrimSpace(task.Cmds) == "" && len(task.Deps) == 0 && !task.Abstract {
+			problems = append(problems, s.problem(path, "task %q has no cmds nor deps", name))
+		}
+		problems = append(problems, d.validateDeps(path, task.Deps, commands)...)
+	}
+
+	private := d.Go.Modules.Private
+	if private.Netrc != "" && private.Token.Secret != "" {
+		problems = append(problems, s.problem([]interface{}{"go", "modules", "private"}, "netrc and token can't be used together"))
+	}
+	if name := private.Token.Secret; name != "" {
+		if _, ok := d.Secrets[name]; !ok {
+			problems = append(problems, s.problem([]interface{}{"go", "modules", "private", "token", "secret"}, "unknown secret %q", name))
+		}
+	}
+
+	for _, name := range sortedKeys(d.Secrets) {
+		path := []interface{}{"secrets", name}
+		if err := d.Secrets[name].check(); err != nil {
+			problems = append(problems, s.problem(path, "secret %q: %s", name, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// Check reports an unsupported toolchain, or a platform the toolchain can't build for: zig has no macOS SDK, darwin
+// binaries using cgo must be built on macOS.
+func (c Cgo) Check(platforms []string) error {
+	if c.Toolchain != "" && c.Toolchain != "zig" {
+		return fmt.Errorf("unsupported cgo toolchain %q, only zig is available", c.Toolchain)
+	}
+	for _, p := range platforms {
+		if strings.HasPrefix(p, "darwin/") {
+			return fmt.Errorf("cgo can't build for %s, zig doesn't provide the macOS SDK", p)
+		}
+	}
+	return nil
+}
+
+// validateSecrets checks the secrets used by a target or an exec are defined.
+func (d *Dague) validateSecrets(path []interface{}, names []string) Problems {
+	var problems Problems
+	for i, name := range names {
+		if _, ok := d.Secrets[name]; !ok {
+			secretPath := append(append([]interface{}{}, path...), "secrets", i)
+			problems = append(problems, d.sources.problem(secretPath, "unknown secret %q", name))
+		}
+	}
+	return problems
+}
+
+// validateDeps checks the dependencies are existing commands, and the tasks, exec and targets they reference exist.
+func (d *Dague) validateDeps(path []interface{}, deps []string, commands []string) Problems {
+	known := map[string]bool{}
+	for _, c := range commands {
+		known[c] = true
+	}
+
+	var problems Problems
+	for i, dep := range deps {
+		depPath := append(append([]interface{}{}, path...), "deps", i)
+		fields := strings.Fields(dep)
+		if len(fields) == 0 {
+			problems = append(problems, d.sources.problem(depPath, "empty dependency"))
+			continue
+		}
+		name, args := fields[0], fields[1:]
+		if !known[name] {
+			problems = append(problems, d.sources.problem(depPath, "unknown command %q in dependency %q", name, dep))
+			continue
+		}
+		for _, arg := range args {
+			var exists, abstract bool
+			switch name {
+			case "task":
+				var task Task
+				task, exists = d.Tasks[arg]
+				abstract = task.Abstract
+			case "go:exec":
+				var exec Exec
+				exec, exists = d.Go.Exec[arg]
+				abstract = exec.Abstract
+			case "go:build", "go:install", "go:release":
+				var target Target
+				target, exists = d.Go.Build.Targets[arg]
+				abstract = target.Abstract
+			default:
+				exists = true
+			}
+			switch {
+			case !exists:
+				problems = append(problems, d.sources.problem(depPath, "%q in dependency %q does not exist", arg, dep))
+			case abstract:
+				problems = append(problems, d.sources.problem(depPath, "%q in dependency %q is abstract, it can only be extended", arg, dep))
+			}
+		}
+	}
+	return problems
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// load writes the configuration to a .dague.yml file of a temporary directory and loads it. The path of the file is
+// returned to check the positions of the problems.
+func load(t *testing.T, content string, strict bool) (Dague, string, error) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), ".dague.yml")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Load(context.Background(), Options{File: file, Strict: strict})
+	return d, file, err
+}
+
+func TestUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{
+			name:   "root",
+			config: "taks:\n  build:\n    cmds: make\n",
+			err:    `:1:1: unknown field "taks" in the root, did you mean "tasks"?`,
+		},
+		{
+			name:   "nested",
+			config: "go:\n  build:\n    targest: {}\n",
+			err:    `:3:5: unknown field "targest" in go.build, did you mean "targets"?`,
+		},
+		{
+			name:   "map entry",
+			config: "tasks:\n  build:\n    cmd: make\n",
+			err:    `:3:5: unknown field "cmd" in tasks.build, did you mean "cmds"?`,
+		},
+		{
+			name:   "without hint",
+			config: "go:\n  image:\n    registry: docker.io\n",
+			err:    `:3:5: unknown field "registry" in go.image`,
+		},
+		{
+			name:   "duplicated",
+			config: "tasks:\n  build:\n    cmds: make\n  build:\n    cmds: make all\n",
+			err:    `:4:3: key "build" is already defined`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, file, err := load(t, tt.config, true)
+			if err == nil || err.Error() != file+tt.err {
+				t.Fatalf("expected error %q, got %v", file+tt.err, err)
+			}
+
+			// without the strict mode, the configuration is loaded and the problems are reported by Validate
+			d, _, err := load(t, tt.config, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Validate(nil); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected validation error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"github.com/eunomie/dague/internal/git"
+	"github.com/eunomie/dague/internal/shell"
+)
+
+// gitVars are the built-in variables computed from the git repository.
+var gitVars = []string{
+	"VERSION", "GIT_TAG", "GIT_COMMIT", "GIT_SHORT_COMMIT", "GIT_BRANCH", "GIT_DIRTY", "GIT_COMMIT_DATE",
+}
+
+// builtinVars returns the variables available by default, that can be overridden in the vars section: the version
+// of the project computed from the git repository, without requiring a git binary, and the build date.
+// Outside a git repository or before the first commit, only the build date is available. If the repository can't be
+// read, the build date is returned with the error.
+func builtinVars() (map[string]string, error) {
+	vars := map[string]string{
+		"BUILD_DATE": buildDate().Format(time.RFC3339),
+	}
+
+	repo, err := git.Open(".")
+	if errors.Is(err, git.ErrNotFound) {
+		return vars, nil
+	}
+	if err != nil {
+		return vars, fmt.Errorf("could not read the git repository: %w", err)
+	}
+	defer repo.Close()
+	v, err := repo.Version()
+	if errors.Is(err, git.ErrNoCommit) {
+		// a new repository has no version yet
+		return vars, nil
+	}
+	if err != nil {
+		return vars, fmt.Errorf("could not compute the version from the git repository: %w", err)
+	}
+	vars["VERSION"] = v.Semver
+	vars["GIT_TAG"] = v.Tag
+	vars["GIT_COMMIT"] = v.Commit
+	vars["GIT_SHORT_COMMIT"] = v.ShortCommit
+	vars["GIT_BRANCH"] = v.Branch
+	vars["GIT_DIRTY"] = strconv.FormatBool(v.Dirty)
+	vars["GIT_COMMIT_DATE"] = v.CommitDate.Format(time.RFC3339)
+	return vars, nil
+}
+
+// buildDate is the current time, unless SOURCE_DATE_EPOCH is set for reproducible builds.
+func buildDate() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC()
+	}
+	return time.Now().UTC()
+}
+
+// readDotenv reads the dotenv files of the configuration, ignoring the missing ones, then the dotenv files given on
+// the command line. Later files override earlier ones.
+func readDotenv(files, required []string) (map[string]string, error) {
+	vars := map[string]string{}
+	read := func(file string, optional bool) error {
+		data, err := os.ReadFile(file)
+		if optional && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read dotenv file: %w", err)
+		}
+		values, err := godotenv.UnmarshalBytes(data)
+		if err != nil {
+			return fmt.Errorf("could not parse dotenv file %s: %w", file, err)
+		}
+		for k, v := range values {
+			vars[k] = v
+		}
+		return nil
+	}
+	for _, f := range files {
+		if err := read(f, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range required {
+		if err := read(f, false); err != nil {
+			return nil, err
+		}
+	}
+	return vars, nil
+}
+
+// parseVars parses the variables given as KEY=VALUE.
+func parseVars(defs []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, def := range defs {
+		k, v, ok := strings.Cut(def, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid variable %q, expected KEY=VALUE", def)
+		}
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+// resolver resolves the variables lazily, on first use. A variable can reference other variables, that are resolved
+// first, and is only evaluated once per run.
+// From the lowest to the highest priority, variables are the built-in ones, the dotenv ones, the defined ones and the
+// overrides.
+type resolver struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	defs     map[string]string
+	dotenv   map[string]string
+	builtins map[string]string
+	// builtinsErr is the error reading the git repository, returned when a git variable is used
+	builtinsErr error
+	values      map[string]string
+	stack       []string
+	// secrets are the values of the secrets read, by name.
+	secrets map[string]string
+}
+
+func newResolver(ctx context.Context, defs, dotenv, overrides map[string]string) *resolver {
+	values := map[string]string{}
+	for k, v := range overrides {
+		values[k] = v
+	}
+	return &resolver{ctx: ctx, defs: defs, dotenv: dotenv, values: values}
+}
+
+// names returns the names of all the variables, built-in and defined.
+func (r *resolver) names() []string {
+	var names []string
+	seen := map[string]bool{}
+	for k := range r.builtinVars() {
+		names = append(names, k)
+		seen[k] = true
+	}
+	if r.builtinsErr != nil {
+		// resolving them returns the error
+		for _, k := range gitVars {
+			if !seen[k] {
+				names = append(names, k)
+				seen[k] = true
+			}
+		}
+	}
+	for _, vars := range []map[string]string{r.dotenv, r.defs, r.values} {
+		for k := range vars {
+			if !seen[k] {
+				names = append(names, k)
+				seen[k] = true
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// builtinVars computes the built-in variables on first use, as it requires to read the git repository.
+func (r *resolver) builtinVars() map[string]string {
+	if r.builtins == nil {
+		r.builtins, r.builtinsErr = builtinVars()
+	}
+	return r.builtins
+}
+
+// get returns the value of the variable, and false if it's not defined.
+func (r *resolver) get(name string) (string, bool, error) {
+	if v, ok := r.values[name]; ok {
+		return v, true, nil
+	}
+	def, ok := r.defs[name]
+	if !ok {
+		return r.base(name)
+	}
+
+	for i, n := range r.stack {
+		if n == name {
+			return "", false, fmt.Errorf("variables cycle: %s -> %s", strings.Join(r.stack[i:], " -> "), name)
+		}
+	}
+	r.stack = append(r.stack, name)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	isShell := strings.HasPrefix(def, "shell ")
+	script := strings.TrimPrefix(def, "shell ")
+	refs, err := references(script, isShell, true)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid variable %s: %w", name, err)
+	}
+	env, err := r.lookup(refs, name)
+	if err != nil {
+		return "", false, err
+	}
+
+	var value string
+	if isShell {
+		if script, err = RenderTemplate(script, env); err == nil {
+			value, err = shell.Interpret(r.ctx, script, env)
+		}
+	} else {
+		value, err = Render(def, env)
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("could not evaluate variable %s: %w", name, err)
+	}
+	r.values[name] = value
+	return value, true, nil
+}
+
+// lookup resolves the referenced variables, ignoring the undefined ones. A variable referencing itself, self, gets
+// the value it overrides: a dotenv variable, a built-in variable or the environment.
+func (r *resolver) lookup(refs []string, self string) (map[string]string, error) {
+	env := map[string]string{}
+	for _, ref := range refs {
+		if ref == self {
+			v, ok, err := r.base(self)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				env[ref] = v
+			} else if v, ok := os.LookupEnv(self); ok {
+				env[ref] = v
+			}
+			continue
+		}
+		v, ok, err := r.get(ref)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			env[ref] = v
+		}
+	}
+	return env, nil
+}
+
+// base returns the value of the variable, ignoring its definition: from the dotenv files, or built-in. It fails for a
+// git variable if the repository can't be read.
+func (r *resolver) base(name string) (string, bool, error) {
+	if v, ok := r.dotenv[name]; ok {
+		return v, true, nil
+	}
+	v, ok := r.builtinVars()[name]
+	if !ok && r.builtinsErr != nil {
+		for _, k := range gitVars {
+			if k == name {
+				return "", false, r.builtinsErr
+			}
+		}
+	}
+	return v, ok, nil
+}
+
+// expand renders the Go template and expands the variables of the string, resolving only the variables it references.
+func (r *resolver) expand(s string) (string, error) {
+	refs, err := references(s, false, false)
+	if err != nil {
+		return "", err
+	}
+	env, err := r.lookup(refs, "")
+	if err != nil {
+		return "", err
+	}
+	return Render(s, env)
+}
+
+// template renders the Go template of the shell script, resolving only the variables it references.
+func (r *resolver) template(script string) (string, error) {
+	refs, err := references(script, true, false)
+	if err != nil {
+		return "", err
+	}
+	env, err := r.lookup(refs, "")
+	if err != nil {
+		return "", err
+	}
+	return RenderTemplate(script, env)
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnreferencedVarsNotRun(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	d := Dague{Vars: map[string]string{
+		"UNUSED": "shell touch " + marker,
+		"NAME":   "shell echo dague",
+	}}
+
+	vars, err := d.ScriptVars("echo $NAME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vars) != 1 || vars["NAME"] != "dague" {
+		t.Errorf("expected only NAME to be resolved by the script, got %v", vars)
+	}
+	vars, err = d.ReferencedVars([]string{"-X main.name={{ .NAME }}", "shell echo ${NAME}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vars) != 1 || vars["NAME"] != "dague" {
+		t.Errorf("expected only NAME to be referenced, got %v", vars)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("the unreferenced UNUSED variable must not be run")
+	}
+}
@@ -19,7 +19,7 @@ func GoBase(c *Client) *dagger.Container {
 		WithExec(dague.GoInstall("golang.org/x/tools/cmd/goimports@latest")).
 		WithExec(dague.GoInstall("github.com/princjef/gomarkdoc/cmd/gomarkdoc@latest"))
 
-	base = applyBase(base, c.Dagger, c.Config)
+	base = applyBase(base, c)
 
 	if len(c.Config.Go.Image.ApkPackages) > 0 {
 		base = base.WithExec(dague.ApkInstall(c.Config.Go.Image.ApkPackages...))
@@ -36,13 +36,11 @@ func GoBase(c *Client) *dagger.Container {
 
 // GoDeps mount the Go module files and download the needed dependencies.
 func GoDeps(c *Client) *dagger.Container {
-	return GoBase(c).
-		WithMountedDirectory(c.Config.Go.AppDir, goModFiles(c)).
-		WithExec(goModDownload())
+	return withModulesDownload(c, GoBase(c).WithMountedDirectory(c.Config.Go.AppDir, goModFiles(c)))
 }
 
 func sources(c *Client, cont *dagger.Container) *dagger.Container {
-	return cont.WithMountedDirectory(c.Config.Go.AppDir, c.Dagger.Host().Directory("."))
+	return cont.WithMountedDirectory(c.Config.Go.AppDir, c.Dagger.Host().Directory(".", c.sourcesOpts))
 }
 
 // Sources is a container based on GoDeps. It contains the Go source code but also all the needed dependencies from
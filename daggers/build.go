@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"path/filepath"
 	"runtime"
+	"strings"
 
 	"dagger.io/dagger"
 	"golang.org/x/sync/errgroup"
@@ -13,48 +15,194 @@ import (
 	"github.com/eunomie/dague/types"
 )
 
-func LocalBuild(ctx context.Context, c *Client, buildOpts types.LocalBuildOpts) error {
-	file := path.Join(buildOpts.Dir, buildOpts.Out)
-	return goBuild(ctx, c, Sources(c), runtime.GOOS, runtime.GOARCH, buildOpts.BuildOpts, file)
+// pgoProfile is the path of the profile for profile-guided optimization in the build container.
+const pgoProfile = "/run/dague/default.pgo"
+
+// LocalBuild builds the binary for the local platform from the src container, usually Sources.
+func LocalBuild(ctx context.Context, c *Client, src *dagger.Container, buildOpts types.LocalBuildOpts) ([]types.Artifact, error) {
+	platform := types.Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	artifact, err := goBuild(ctx, c, src, platform, buildOpts.BuildOpts)
+	if err != nil {
+		return nil, err
+	}
+	if err := exportPublicKey(ctx, c, src, buildOpts.BuildOpts); err != nil {
+		return nil, err
+	}
+	return []types.Artifact{artifact}, nil
 }
 
-func CrossBuild(ctx context.Context, c *Client, buildOpts types.CrossBuildOpts) error {
-	g, ctx := errgroup.WithContext(ctx)
+// CrossBuild builds the binaries for all the platforms concurrently from the src container, usually Sources.
+func CrossBuild(ctx context.Context, c *Client, src *dagger.Container, buildOpts types.CrossBuildOpts) ([]types.Artifact, error) {
+	if err := validatePlatforms(ctx, c, buildOpts.Platforms); err != nil {
+		return nil, err
+	}
+	if buildOpts.Cgo != nil {
+		for _, platform := range buildOpts.Platforms {
+			if _, err := zigTarget(platform, buildOpts.Cgo.Static); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-	src := Sources(c)
+	g, ctx := errgroup.WithContext(ctx)
 
-	for _, platform := range buildOpts.Platforms {
-		goos := platform.OS
-		goarch := platform.Arch
+	artifacts := make([]types.Artifact, len(buildOpts.Platforms))
+	for i, platform := range buildOpts.Platforms {
+		i, platform := i, platform
 		g.Go(func() error {
-			file := fmt.Sprintf(path.Join(buildOpts.Dir, buildOpts.OutFileFormat), goos, goarch)
-			return goBuild(ctx, c, src, goos, goarch, buildOpts.BuildOpts, file)
+			artifact, err := goBuild(ctx, c, src, platform, buildOpts.BuildOpts)
+			artifacts[i] = artifact
+			return err
 		})
 	}
-	return g.Wait()
+	g.Go(func() error {
+		return exportPublicKey(ctx, c, src, buildOpts.BuildOpts)
+	})
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return artifacts, nil
 }
 
-func goBuild(ctx context.Context, c *Client, src *dagger.Container, os, arch string, buildOpts types.BuildOpts, buildFile string) error {
-	var (
-		absoluteFileInContainer = path.Join(c.Config.Go.AppDir, buildFile)
-		localFile               = path.Join("./", buildFile)
-	)
+// validatePlatforms checks the platforms are supported by the Go toolchain of the build image.
+func validatePlatforms(ctx context.Context, c *Client, platforms []types.Platform) error {
+	out, err := GoBase(c).WithExec([]string{"go", "tool", "dist", "list"}).Stdout(ctx)
+	if err != nil {
+		return err
+	}
+	supported := map[string]bool{}
+	for _, p := range strings.Fields(out) {
+		supported[p] = true
+	}
+	for _, p := range platforms {
+		if !supported[p.OS+"/"+p.Arch] {
+			return fmt.Errorf("platform %s is not supported by the Go toolchain (see go tool dist list)", p)
+		}
+	}
+	return nil
+}
+
+// OutFiles returns the binaries generated by the build for each platform, the local one without platforms. The
+// signatures are named after them.
+func OutFiles(buildOpts types.CrossBuildOpts) ([]string, []types.Platform, error) {
+	platforms := buildOpts.Platforms
+	if len(platforms) == 0 {
+		platforms = []types.Platform{{OS: runtime.GOOS, Arch: runtime.GOARCH}}
+	}
+	var files []string
+	for _, platform := range platforms {
+		f, err := outFile(buildOpts.BuildOpts, platform)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, f)
+	}
+	return files, platforms, nil
+}
 
-	cont := src.
-		WithEnvVariable("GOOS", os).
-		WithEnvVariable("GOARCH", arch)
+// outFile renders the path of the binary to generate for the platform.
+func outFile(buildOpts types.BuildOpts, platform types.Platform) (string, error) {
+	var name strings.Builder
+	err := buildOpts.OutTemplate.Execute(&name, types.OutTemplateData{
+		Name:    buildOpts.Name,
+		OS:      platform.OS,
+		Arch:    platform.Arch,
+		Variant: platform.Variant,
+		Version: buildOpts.Version,
+		Ext:     ext(platform, buildOpts.Buildmode),
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not render output name for %s: %w", platform, err)
+	}
+	return path.Join(buildOpts.Dir, name.String()), nil
+}
+
+// ext returns the extension of the generated file, depending on the platform and the build mode.
+func ext(platform types.Platform, buildmode string) string {
+	switch buildmode {
+	case "c-archive":
+		return ".a"
+	case "plugin":
+		return ".so"
+	case "c-shared":
+		switch platform.OS {
+		case "windows":
+			return ".dll"
+		case "darwin":
+			return ".dylib"
+		default:
+			return ".so"
+		}
+	}
+	return platform.Ext()
+}
+
+func goBuild(ctx context.Context, c *Client, src *dagger.Container, platform types.Platform, buildOpts types.BuildOpts) (types.Artifact, error) {
+	buildFile, err := outFile(buildOpts, platform)
+	if err != nil {
+		return types.Artifact{}, err
+	}
+	localFile := path.Join("./", buildFile)
+
+	platformEnv, err := platform.Env()
+	if err != nil {
+		return types.Artifact{}, err
+	}
+
+	cont := src
+	for k, v := range platformEnv {
+		cont = cont.WithEnvVariable(k, v)
+	}
 	for k, v := range buildOpts.EnvVars {
 		cont = cont.WithEnvVariable(k, v)
 	}
-	ok, err := cont.WithExec(
+	cont = WithSecrets(cont, c, buildOpts.Secrets)
+	if buildOpts.Cgo != nil {
+		cont, err = withCgo(c, cont, platform, buildOpts.Cgo)
+		if err != nil {
+			return types.Artifact{}, err
+		}
+	}
+	flags := buildOpts.BuildFlags
+	if buildOpts.Pgo != "" {
+		// the profile can be outside of the sources, or excluded from them
+		cont = cont.WithFile(pgoProfile, c.Dagger.Host().Directory(filepath.Dir(buildOpts.Pgo)).File(filepath.Base(buildOpts.Pgo)))
+		flags = append(flags[:len(flags):len(flags)], "-pgo="+pgoProfile)
+	}
+	cont = cont.WithExec(
 		append([]string{"go", "build"},
-			append(buildOpts.BuildFlags, "-o", localFile, buildOpts.In)...),
-	).File(absoluteFileInContainer).Export(ctx, localFile)
-	if err != nil {
-		return err
+			append(flags, "-o", localFile, buildOpts.In)...),
+	)
+	files := []string{localFile}
+	if buildOpts.Sign != nil {
+		var sigs []string
+		cont, sigs = signBlob(withCosign(c, cont, buildOpts.Sign), localFile, buildOpts.Sign)
+		files = append(files, sigs...)
+	}
+	if err := exportFiles(ctx, c, cont, files); err != nil {
+		return types.Artifact{}, err
 	}
-	if !ok {
-		return errors.New("could not export " + buildFile)
+	return types.Artifact{Target: buildOpts.Target, Path: localFile, Platform: platform}, nil
+}
+
+// exportPublicKey exports the public key next to the binaries when signatures are bundled.
+func exportPublicKey(ctx context.Context, c *Client, src *dagger.Container, buildOpts types.BuildOpts) error {
+	if buildOpts.Sign == nil || !buildOpts.Sign.Bundle {
+		return nil
+	}
+	cont, pub := publicKey(withCosign(c, src, buildOpts.Sign), path.Join("./", buildOpts.Dir))
+	return exportFiles(ctx, c, cont, []string{pub})
+}
+
+func exportFiles(ctx context.Context, c *Client, cont *dagger.Container, files []string) error {
+	for _, f := range files {
+		ok, err := cont.File(path.Join(c.Config.Go.AppDir, f)).Export(ctx, f)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("could not export " + f)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,96 @@
+package daggers
+
+import (
+	"fmt"
+
+	"dagger.io/dagger"
+
+	"github.com/eunomie/dague/types"
+)
+
+const (
+	zigCache = "/cache/zig"
+	// zigVersion is the version of zig installed from the official tarball, on the images without apk.
+	zigVersion = "0.10.1"
+)
+
+// installZig installs zig with apk on alpine based images, where it is packaged, or from the official tarball otherwise,
+// like on debian based images.
+const installZig = `set -e
+if command -v apk >/dev/null; then
+  apk add zig
+  exit
+fi
+case "$(uname -m)" in
+x86_64 | aarch64) arch="$(uname -m)" ;;
+*)
+  echo "could not install zig: unsupported architecture $(uname -m)" >&2
+  exit 1
+  ;;
+esac
+if ! command -v xz >/dev/null; then
+  apt-get update && apt-get install --no-install-recommends -y xz-utils && rm -rf /var/lib/apt/lists/*
+fi
+mkdir -p /usr/local/zig
+curl -fsSL "https://ziglang.org/download/$1/zig-linux-$arch-$1.tar.xz" | tar -xJ -C /usr/local/zig --strip-components=1
+ln -sf /usr/local/zig/zig /usr/local/bin/zig`
+
+// zigTargets maps Go platforms to zig targets. Linux targets are completed with the libc to use. Darwin is not
+// supported, zig doesn't provide the macOS SDK.
+var zigTargets = map[string]string{
+	"linux/386":      "x86-linux",
+	"linux/amd64":    "x86_64-linux",
+	"linux/arm":      "arm-linux",
+	"linux/arm64":    "aarch64-linux",
+	"linux/mips64le": "mips64el-linux",
+	"linux/ppc64le":  "powerpc64le-linux",
+	"linux/riscv64":  "riscv64-linux",
+	"linux/s390x":    "s390x-linux",
+	"windows/386":    "x86-windows-gnu",
+	"windows/amd64":  "x86_64-windows-gnu",
+	"windows/arm64":  "aarch64-windows-gnu",
+	"freebsd/amd64":  "x86_64-freebsd",
+}
+
+// withCgo provisions the C cross toolchain in the container and configures cgo to use it for the platform.
+func withCgo(c *Client, cont *dagger.Container, platform types.Platform, cgoOpts *types.CgoOpts) (*dagger.Container, error) {
+	target, err := zigTarget(platform, cgoOpts.Static)
+	if err != nil {
+		return nil, err
+	}
+
+	cont = cont.
+		WithExec([]string{"sh", "-c", installZig, "sh", zigVersion}).
+		WithMountedCache(zigCache, c.Dagger.CacheVolume(zigCache)).
+		WithEnvVariable("ZIG_GLOBAL_CACHE_DIR", zigCache).
+		WithEnvVariable("ZIG_LOCAL_CACHE_DIR", zigCache).
+		WithEnvVariable("CGO_ENABLED", "1").
+		WithEnvVariable("CC", "zig cc -target "+target).
+		WithEnvVariable("CXX", "zig c++ -target "+target)
+	if cgoOpts.Cflags != "" {
+		cont = cont.WithEnvVariable("CGO_CFLAGS", cgoOpts.Cflags)
+	}
+	if cgoOpts.Static && platform.OS == "linux" {
+		cont = cont.WithEnvVariable("CGO_LDFLAGS", "-static")
+	}
+	return cont, nil
+}
+
+// zigTarget returns the zig target for the platform. Static linux builds are based on musl, dynamic ones on glibc.
+func zigTarget(platform types.Platform, static bool) (string, error) {
+	target, ok := zigTargets[platform.OS+"/"+platform.Arch]
+	if !ok {
+		return "", fmt.Errorf("cgo is not supported for platform %s", platform)
+	}
+	if platform.OS != "linux" {
+		return target, nil
+	}
+	libc := "gnu"
+	if static {
+		libc = "musl"
+	}
+	if platform.Arch == "arm" {
+		libc += "eabihf"
+	}
+	return target + "-" + libc, nil
+}
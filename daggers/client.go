@@ -4,11 +4,23 @@ import (
 	"dagger.io/dagger"
 
 	"github.com/eunomie/dague/config"
+	"github.com/eunomie/dague/internal/workspace"
 )
 
 type Client struct {
 	Dagger *dagger.Client
 	Config *config.Dague
+
+	// sourcesOpts filters the files of the project uploaded to the containers.
+	sourcesOpts dagger.HostDirectoryOpts
+	// modules are the Go modules of the project.
+	modules []workspace.Module
+	// work is set when the project has a go.work file.
+	work bool
+	// requirements are the module versions required by the modules of the workspace, as path@version.
+	requirements []string
+	// knownHosts is the host known_hosts file checking the keys of the hosts of the private modules.
+	knownHosts string
 }
 
 func NewClient(c *dagger.Client, conf *config.Dague) *Client {
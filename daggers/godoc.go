@@ -6,19 +6,29 @@ import (
 	"github.com/eunomie/dague"
 )
 
-func GoDoc(ctx context.Context, c *Client) error {
+// GoDoc generates the documentation of the modules in dirs and exports the readme files.
+func GoDoc(ctx context.Context, c *Client, dirs []string) error {
+	cont := SourcesNoDeps(c)
+	for _, dir := range dirs {
+		cont = cont.WithWorkdir(moduleDir(c, dir)).WithExec(goDocWrite())
+	}
 	return dague.ExportFilePattern(
 		ctx,
-		SourcesNoDeps(c).WithExec([]string{"gomarkdoc", "-u", "-e", "-o", "{{.Dir}}/README.md", "./..."}),
+		cont.WithWorkdir(c.Config.Go.AppDir),
 		"*.md",
 		".",
 	)
 }
 
-func CheckGoDoc(ctx context.Context, c *Client) error {
+// CheckGoDoc checks the documentation of the module in dir is up-to-date.
+func CheckGoDoc(ctx context.Context, c *Client, dir string) error {
 	return dague.Exec(
 		ctx,
-		SourcesNoDeps(c),
+		SourcesNoDeps(c).WithWorkdir(moduleDir(c, dir)),
 		[]string{"gomarkdoc", "-c", "-u", "-e", "-o", "{{.Dir}}/README.md", "./..."},
 	)
 }
+
+func goDocWrite() []string {
+	return []string{"gomarkdoc", "-u", "-e", "-o", "{{.Dir}}/README.md", "./..."}
+}
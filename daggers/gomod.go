@@ -2,37 +2,65 @@ package daggers
 
 import (
 	"context"
+	"path"
 
 	"dagger.io/dagger"
-
-	"github.com/eunomie/dague"
 )
 
-var goModDefaulFiles = []string{"go.mod", "go.sum"}
+// goModPatterns are the files of the modules and of the workspace.
+var goModPatterns = []string{"go.work", "go.work.sum", "**/go.mod", "**/go.sum"}
 
-func GoMod(c *Client) *dagger.Container {
+// GoMod runs go mod tidy in the module directory.
+func GoMod(c *Client, dir string) *dagger.Container {
 	return Sources(c).
-		WithWorkdir(c.Config.Go.AppDir).
+		WithWorkdir(moduleDir(c, dir)).
 		WithExec(goModTidy())
 }
 
-func ExportGoMod(ctx context.Context, c *Client) error {
-	return dague.ExportFilePattern(
-		ctx,
-		GoMod(c),
-		"go.*",
-		"./",
-	)
+// ExportGoMod runs go mod tidy in the module directory and exports its go.mod and go.sum files.
+func ExportGoMod(ctx context.Context, c *Client, dir string) error {
+	cont := GoMod(c, dir)
+	entries, err := cont.Directory(moduleDir(c, dir)).Entries(ctx)
+	if err != nil {
+		return err
+	}
+	var files []string
+	for _, e := range entries {
+		if e == "go.mod" || e == "go.sum" {
+			files = append(files, path.Join(dir, e))
+		}
+	}
+	return exportFiles(ctx, c, cont, files)
 }
 
-// GoModFiles creates a directory containing the default go mod files.
+// GoModFiles creates a directory containing the go mod files of all the modules, and the go.work files.
 func goModFiles(c *Client) *dagger.Directory {
-	src := c.Dagger.Host().Directory(".")
-	goMods := c.Dagger.Directory()
-	for _, f := range goModDefaulFiles {
-		goMods = goMods.WithFile(f, src.File(f))
+	return c.Dagger.Host().Directory(".", dagger.HostDirectoryOpts{Include: goModPatterns})
+}
+
+// withModulesDownload downloads the dependencies of the modules. With a go.work file, the requirements of the modules
+// are downloaded once from the root in workspace mode, so a module requiring another module of the workspace doesn't
+// need it to be published. Otherwise, each module downloads its own dependencies.
+func withModulesDownload(c *Client, cont *dagger.Container) *dagger.Container {
+	if c.work {
+		cont = cont.WithWorkdir(c.Config.Go.AppDir)
+		if len(c.requirements) == 0 {
+			// without arguments, go mod download would load the module graph
+			return cont
+		}
+		return cont.WithExec(append(goModDownload(), c.requirements...))
+	}
+	for _, m := range c.modules {
+		cont = cont.
+			WithWorkdir(moduleDir(c, m.Dir)).
+			WithExec(append([]string{"env", "GOWORK=off"}, goModDownload()...))
 	}
-	return goMods
+	return cont.WithWorkdir(c.Config.Go.AppDir)
+}
+
+// moduleDir is the directory of the module in the containers.
+func moduleDir(c *Client, dir string) string {
+	return path.Join(c.Config.Go.AppDir, dir)
 }
 
 // GoModDownload runs the go mod download command.
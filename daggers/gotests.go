@@ -6,10 +6,11 @@ import (
 	"github.com/eunomie/dague"
 )
 
-func RunGoTests(ctx context.Context, c *Client) error {
+// RunGoTests runs the tests of the module in dir.
+func RunGoTests(ctx context.Context, c *Client, dir string) error {
 	return dague.Exec(
 		ctx,
-		Sources(c),
+		Sources(c).WithWorkdir(moduleDir(c, dir)),
 		[]string{"go", "test", "-race", "-cover", "-shuffle=on", "-v", "./..."},
 	)
 }
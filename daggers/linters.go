@@ -8,18 +8,20 @@ import (
 	"github.com/eunomie/dague"
 )
 
-func GoVulnCheck(ctx context.Context, c *Client) error {
+// GoVulnCheck runs govulncheck on the module in dir.
+func GoVulnCheck(ctx context.Context, c *Client, dir string) error {
 	return dague.Exec(
 		ctx,
-		Sources(c).WithEnvVariable("CGO_ENABLED", "0"),
+		Sources(c).WithEnvVariable("CGO_ENABLED", "0").WithWorkdir(moduleDir(c, dir)),
 		[]string{"govulncheck", "./..."},
 	)
 }
 
-func GolangCILint(ctx context.Context, c *Client) error {
+// GolangCILint runs golangci-lint on the module in dir.
+func GolangCILint(ctx context.Context, c *Client, dir string) error {
 	return dague.Exec(
 		ctx,
-		sources(c, GolangCILintBase(c)),
+		sources(c, GolangCILintBase(c)).WithWorkdir(moduleDir(c, dir)),
 		[]string{"golangci-lint", "run", "-v", "--timeout", "5m"},
 	)
 }
@@ -29,7 +31,7 @@ func GolangCILintBase(c *Client) *dagger.Container {
 		From(c.Config.Go.Lint.Golangci.Image).
 		WithWorkdir(c.Config.Go.AppDir)
 
-	base = applyBase(base, c.Dagger, c.Config)
+	base = applyBase(base, c)
 
 	return base
 }
@@ -0,0 +1,126 @@
+package daggers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"dagger.io/dagger"
+
+	"github.com/eunomie/dague"
+	"github.com/eunomie/dague/config"
+)
+
+const (
+	netrcPath   = "/root/.netrc"
+	sshAuthSock = "/run/ssh-agent.sock"
+	// knownHostsPath is where the host known_hosts file is mounted.
+	knownHostsPath = "/run/ssh_known_hosts"
+	// netrcEnv is the environment variable used to pass the .netrc generated from the token to the dagger engine,
+	// hidden from the scripts run on the host like the secrets.
+	netrcEnv = "DAGUE_NETRC"
+)
+
+// preparePrivateModules checks the host SSH agent and known_hosts file, and generates the .netrc of the token, before
+// connecting to the dagger engine. It returns the path of the known_hosts file.
+func preparePrivateModules(private config.Private, secrets map[string]string) (string, error) {
+	var knownHosts string
+	if private.SSH {
+		if os.Getenv("SSH_AUTH_SOCK") == "" {
+			return "", errors.New("go.modules.private.ssh requires a SSH agent, SSH_AUTH_SOCK is not set")
+		}
+		knownHosts = private.KnownHosts
+		if knownHosts == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("go.modules.private.knownHosts: %w", err)
+			}
+			knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		if _, err := os.Stat(knownHosts); err != nil {
+			return "", fmt.Errorf("go.modules.private.ssh requires a known_hosts file with the keys of the hosts: %w", err)
+		}
+	}
+	token := private.Token
+	if token.Secret == "" {
+		return knownHosts, nil
+	}
+	value, ok := secrets[token.Secret]
+	if !ok {
+		return "", fmt.Errorf("go.modules.private.token: unknown secret %q", token.Secret)
+	}
+	host := token.Host
+	if host == "" {
+		host = "github.com"
+	}
+	login := token.Login
+	if login == "" {
+		login = "x-access-token"
+	}
+	return knownHosts, os.Setenv(netrcEnv, fmt.Sprintf("machine %s\nlogin %s\npassword %s\n", host, login, strings.TrimSpace(value)))
+}
+
+// withPrivateModules gives access to the private modules: the go environment variables, the credentials as a secret
+// .netrc file and the host SSH agent, with git rewriting the https URLs of the private modules to ssh.
+func withPrivateModules(cont *dagger.Container, c *Client) *dagger.Container {
+	private := c.Config.Go.Modules.Private
+	if len(private.Patterns) > 0 {
+		patterns := strings.Join(private.Patterns, ",")
+		cont = cont.
+			WithEnvVariable("GOPRIVATE", patterns).
+			WithEnvVariable("GONOSUMDB", patterns)
+	}
+	if private.Proxy != "" {
+		cont = cont.WithEnvVariable("GOPROXY", private.Proxy)
+	}
+
+	switch {
+	case private.Netrc != "":
+		netrc := c.Dagger.Host().Directory(filepath.Dir(private.Netrc)).File(filepath.Base(private.Netrc)).Secret()
+		cont = cont.WithMountedSecret(netrcPath, netrc)
+	case private.Token.Secret != "":
+		cont = cont.WithMountedSecret(netrcPath, c.Dagger.Host().EnvVariable(netrcEnv).Secret())
+	}
+
+	if private.SSH {
+		// the host keys are the ones of the host, unknown hosts are rejected
+		knownHosts := c.Dagger.Host().Directory(filepath.Dir(c.knownHosts)).File(filepath.Base(c.knownHosts))
+		cont = withSSHClient(cont).
+			WithUnixSocket(sshAuthSock, c.Dagger.Host().UnixSocket(os.Getenv("SSH_AUTH_SOCK"))).
+			WithEnvVariable("SSH_AUTH_SOCK", sshAuthSock).
+			WithMountedFile(knownHostsPath, knownHosts).
+			WithEnvVariable("GIT_SSH_COMMAND", "ssh -o StrictHostKeyChecking=yes -o UserKnownHostsFile="+knownHostsPath)
+		for _, prefix := range repositoryPrefixes(private.Patterns) {
+			cont = cont.WithExec([]string{"git", "config", "--global", "url.ssh://git@" + prefix + ".insteadOf", "https://" + prefix})
+		}
+	}
+	return cont
+}
+
+// withSSHClient installs the ssh client needed by git to fetch the private modules with the SSH agent, with the
+// package manager of the image.
+func withSSHClient(cont *dagger.Container) *dagger.Container {
+	return cont.WithExec(dague.PackageInstall("openssh-client"))
+}
+
+// repositoryPrefixes returns the part of the patterns without wildcard, like github.com/acme/ for github.com/acme/*.
+// Patterns with a wildcard in the host are ignored.
+func repositoryPrefixes(patterns []string) []string {
+	var prefixes []string
+	for _, p := range patterns {
+		var elems []string
+		for _, e := range strings.Split(p, "/") {
+			if e == "" || strings.ContainsAny(e, "*?[") {
+				break
+			}
+			elems = append(elems, e)
+		}
+		if len(elems) == 0 {
+			continue
+		}
+		prefixes = append(prefixes, strings.Join(elems, "/")+"/")
+	}
+	return prefixes
+}
@@ -0,0 +1,29 @@
+package daggers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eunomie/dague/config"
+)
+
+func TestPreparePrivateModulesKnownHosts(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "/run/agent.sock")
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+
+	if _, err := preparePrivateModules(config.Private{SSH: true, KnownHosts: knownHosts}, nil); err == nil {
+		t.Error("expected an error without known_hosts file")
+	}
+
+	if err := os.WriteFile(knownHosts, []byte("github.com ssh-ed25519 AAAA\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := preparePrivateModules(config.Private{SSH: true, KnownHosts: knownHosts}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != knownHosts {
+		t.Errorf("expected the known_hosts file %s to be mounted, got %q", knownHosts, got)
+	}
+}
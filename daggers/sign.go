@@ -0,0 +1,66 @@
+package daggers
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+
+	"dagger.io/dagger"
+
+	"github.com/eunomie/dague/types"
+)
+
+const (
+	cosignBin         = "/usr/local/bin/cosign"
+	cosignKey         = "/run/secrets/cosign.key"
+	cosignPublicKey   = "cosign.pub"
+	cosignPasswordEnv = "COSIGN_PASSWORD"
+)
+
+// withCosign adds the cosign binary to the container, taken from the configured cosign image, and provides the private
+// key and its password as secrets so they never end up in the layers or the logs.
+func withCosign(c *Client, cont *dagger.Container, signOpts *types.SignOpts) *dagger.Container {
+	key := c.Dagger.Host().Directory(filepath.Dir(signOpts.Key)).File(filepath.Base(signOpts.Key)).Secret()
+	return cont.
+		WithFile(cosignBin, c.Dagger.Container().From(signOpts.Image).File("/ko-app/cosign")).
+		WithMountedSecret(cosignKey, key).
+		WithSecretVariable(cosignPasswordEnv, c.Dagger.Host().EnvVariable(signOpts.PasswordEnv).Secret())
+}
+
+// signBlob signs the file with the private key and returns the list of the generated files.
+// Nothing is uploaded to the transparency log, so signing works without network access.
+func signBlob(cont *dagger.Container, file string, signOpts *types.SignOpts) (*dagger.Container, []string) {
+	args, files := signBlobArgs(file, signOpts)
+	return cont.WithExec(args), files
+}
+
+// signBlobArgs returns the cosign command signing the file and the files it generates: the detached signature, file.sig,
+// and the bundle, file.bundle, if enabled.
+func signBlobArgs(file string, signOpts *types.SignOpts) ([]string, []string) {
+	sig := file + ".sig"
+	files := []string{sig}
+	args := []string{"cosign", "sign-blob", "--yes", "--tlog-upload=false", "--key", cosignKey, "--output-signature", sig}
+	if signOpts.Bundle {
+		bundle := file + ".bundle"
+		args = append(args, "--bundle", bundle)
+		files = append(files, bundle)
+	}
+	return append(args, file), files
+}
+
+// publicKey extracts the public key from the private one, to be distributed along with the bundles.
+func publicKey(cont *dagger.Container, dir string) (*dagger.Container, string) {
+	pub := path.Join(dir, cosignPublicKey)
+	return cont.WithExec([]string{"cosign", "public-key", "--key", cosignKey, "--outfile", pub}), pub
+}
+
+// SignFile signs a file of the host, like the checksums of a release, and exports the generated files next to it.
+func SignFile(ctx context.Context, c *Client, file string, signOpts *types.SignOpts) error {
+	localFile := path.Join("./", filepath.ToSlash(file))
+	cont := c.Dagger.Container().
+		From(c.Config.Go.Image.Src).
+		WithWorkdir(c.Config.Go.AppDir).
+		WithFile(path.Join(c.Config.Go.AppDir, localFile), c.Dagger.Host().Directory(filepath.Dir(file)).File(filepath.Base(file)))
+	cont, files := signBlob(withCosign(c, cont, signOpts), localFile, signOpts)
+	return exportFiles(ctx, c, cont, files)
+}
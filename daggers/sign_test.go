@@ -0,0 +1,43 @@
+package daggers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/eunomie/dague/types"
+)
+
+func TestSignBlobArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		opts  types.SignOpts
+		files []string
+	}{
+		{name: "binary", file: "dist/app_linux_amd64", files: []string{"dist/app_linux_amd64.sig"}},
+		{name: "windows binary", file: "dist/app_windows_amd64.exe", files: []string{"dist/app_windows_amd64.exe.sig"}},
+		{
+			name:  "checksums with bundle",
+			file:  "dist/checksums.txt",
+			opts:  types.SignOpts{Bundle: true},
+			files: []string{"dist/checksums.txt.sig", "dist/checksums.txt.bundle"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			args, files := signBlobArgs(tt.file, &opts)
+			if !reflect.DeepEqual(files, tt.files) {
+				t.Errorf("expected the files %v, got %v", tt.files, files)
+			}
+			if args[len(args)-1] != tt.file {
+				t.Errorf("expected %s to be signed, got %v", tt.file, args)
+			}
+			for _, f := range files {
+				if !contains(args, f) {
+					t.Errorf("expected cosign to write %s, got %v", f, args)
+				}
+			}
+		})
+	}
+}
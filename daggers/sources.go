@@ -0,0 +1,191 @@
+package daggers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"dagger.io/dagger"
+
+	"github.com/eunomie/dague/config"
+)
+
+const dagueignoreFile = ".dagueignore"
+
+// sourcesOpts returns the filters of the files of the project uploaded to the containers: the patterns of the
+// .gitignore file if enabled, then the ones of the .dagueignore file and the configuration.
+func sourcesOpts(sources config.Sources) (dagger.HostDirectoryOpts, error) {
+	var exclude []string
+	if sources.Gitignore {
+		patterns, err := readIgnoreFile(".gitignore", gitignorePattern)
+		if err != nil {
+			return dagger.HostDirectoryOpts{}, err
+		}
+		exclude = append(exclude, patterns...)
+	}
+	patterns, err := readIgnoreFile(dagueignoreFile, func(p string) string { return p })
+	if err != nil {
+		return dagger.HostDirectoryOpts{}, err
+	}
+	exclude = append(exclude, patterns...)
+	exclude = append(exclude, sources.Exclude...)
+	return dagger.HostDirectoryOpts{Include: sources.Include, Exclude: exclude}, nil
+}
+
+// readIgnoreFile reads the patterns of the file, if it exists, ignoring the empty lines and the comments.
+func readIgnoreFile(file string, convert func(string) string) ([]string, error) {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if p := convert(line); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+// gitignorePattern converts a .gitignore pattern to the .dockerignore syntax of dagger: a pattern without slash, other
+// than a trailing one, matches at any depth, the others are relative to the root of the project.
+func gitignorePattern(p string) string {
+	negate := strings.HasPrefix(p, "!")
+	p = strings.TrimPrefix(p, "!")
+	p = strings.TrimSuffix(p, "/")
+	if strings.HasPrefix(p, "/") {
+		p = strings.TrimPrefix(p, "/")
+	} else if !strings.Contains(p, "/") {
+		p = "**/" + p
+	}
+	if p == "" || p == "**/" {
+		return ""
+	}
+	if negate {
+		return "!" + p
+	}
+	return p
+}
+
+// goToolFiles are the files read by the tools running on the Go inputs, always uploaded with them: the configuration of
+// golangci-lint and the readme files embedding the documentation of go:doc.
+var goToolFiles = []string{
+	"**/.golangci.yml", "**/.golangci.yaml", "**/.golangci.toml", "**/.golangci.json",
+	"**/README.md",
+}
+
+// goSourcePatterns are the files go list reads to find the packages and their files: the module files and the source
+// files of all the kinds known by the Go toolchain. The embedded files are not needed, the patterns are listed instead.
+var goSourcePatterns = append([]string{
+	"**/*.go", "**/vendor/modules.txt",
+	"**/*.c", "**/*.cc", "**/*.cxx", "**/*.cpp", "**/*.m", "**/*.h", "**/*.hh", "**/*.hpp", "**/*.hxx",
+	"**/*.f", "**/*.F", "**/*.for", "**/*.f90", "**/*.s", "**/*.S", "**/*.sx", "**/*.swig", "**/*.swigcxx", "**/*.syso",
+}, goModPatterns...)
+
+// goPackage is the part of the go list -json output listing the files of a package.
+type goPackage struct {
+	Dir                string
+	GoFiles            []string
+	CgoFiles           []string
+	CFiles             []string
+	CXXFiles           []string
+	MFiles             []string
+	HFiles             []string
+	FFiles             []string
+	SFiles             []string
+	SwigFiles          []string
+	SwigCXXFiles       []string
+	SysoFiles          []string
+	TestGoFiles        []string
+	XTestGoFiles       []string
+	IgnoredGoFiles     []string
+	IgnoredOtherFiles  []string
+	EmbedPatterns      []string
+	TestEmbedPatterns  []string
+	XTestEmbedPatterns []string
+}
+
+// goInputs lists the files needed by the Go commands, using go list in each module on the source files only, so the
+// listing doesn't upload the whole project. The files ignored by build constraints are kept, as they are needed to build
+// other platforms. The module files of all the modules and the workspace are always included, with the vendor
+// directories and the files of the tools, see goToolFiles.
+func goInputs(ctx context.Context, c *Client) ([]string, error) {
+	inputs := append(append([]string{}, goModPatterns...), goToolFiles...)
+	src := c.Dagger.Host().Directory(".", dagger.HostDirectoryOpts{Include: goSourcePatterns, Exclude: c.sourcesOpts.Exclude})
+	cont := GoBase(c).WithMountedDirectory(c.Config.Go.AppDir, src)
+	for _, m := range c.modules {
+		inputs = append(inputs, path.Join(m.Dir, "vendor"))
+		out, err := cont.
+			WithWorkdir(moduleDir(c, m.Dir)).
+			WithExec(goListFiles()).
+			Stdout(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not list the Go inputs of %s: %w", m.Dir, err)
+		}
+		files, err := packagesFiles(c.Config.Go.AppDir, out)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, files...)
+	}
+	return inputs, nil
+}
+
+// goListFiles lists the packages of the module and their files, without loading their dependencies.
+func goListFiles() []string {
+	return []string{"go", "list", "-e", "-find", "-json", "./..."}
+}
+
+// packagesFiles returns the files of the packages of the go list -json output, relative to the root directory. The
+// embed patterns are kept as patterns, relative to the package.
+func packagesFiles(root, out string) ([]string, error) {
+	var inputs []string
+	dec := json.NewDecoder(strings.NewReader(out))
+	for {
+		var pkg goPackage
+		if err := dec.Decode(&pkg); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("could not parse the Go inputs: %w", err)
+		}
+		dir, err := filepath.Rel(root, pkg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.ToSlash(dir)
+		for _, files := range [][]string{
+			pkg.GoFiles, pkg.CgoFiles, pkg.CFiles, pkg.CXXFiles, pkg.MFiles, pkg.HFiles, pkg.FFiles, pkg.SFiles,
+			pkg.SwigFiles, pkg.SwigCXXFiles, pkg.SysoFiles, pkg.TestGoFiles, pkg.XTestGoFiles, pkg.IgnoredGoFiles,
+			pkg.IgnoredOtherFiles,
+		} {
+			for _, f := range files {
+				inputs = append(inputs, path.Join(dir, f))
+			}
+		}
+		for _, patterns := range [][]string{pkg.EmbedPatterns, pkg.TestEmbedPatterns, pkg.XTestEmbedPatterns} {
+			for _, p := range patterns {
+				// all: only changes the files matched in the directories, all of them are uploaded
+				inputs = append(inputs, path.Join(dir, strings.TrimPrefix(p, "all:")))
+			}
+		}
+		inputs = append(inputs, path.Join(dir, "testdata"))
+	}
+	return inputs, nil
+}
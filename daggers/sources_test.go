@@ -0,0 +1,133 @@
+package daggers
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPackagesFilesCrossBuild(t *testing.T) {
+	project := t.TempDir()
+	writeFiles(t, project, map[string]string{
+		"go.mod":  "module example.com/asm\n\ngo 1.19\n",
+		"main.go": "package main\n\nimport \"example.com/asm/add\"\n\nfunc main() { println(add.Add(1, 2)) }\n",
+		"add/add.go": "package add\n\nimport _ \"embed\"\n\n//go:embed data/*.txt\nvar Data string\n\n" +
+			"func Add(a, b int) int { return add(a, b) }\n\nfunc add(a, b int) int\n",
+		"add/add_amd64.s": "#include \"textflag.h\"\n\nTEXT ·add(SB),NOSPLIT,$0-24\n" +
+			"\tMOVQ a+0(FP), AX\n\tADDQ b+8(FP), AX\n\tMOVQ AX, ret+16(FP)\n\tRET\n",
+		"add/add_arm64.s": "#include \"textflag.h\"\n\nTEXT ·add(SB),NOSPLIT,$0-24\n" +
+			"\tMOVD a+0(FP), R0\n\tMOVD b+8(FP), R1\n\tADD R1, R0\n\tMOVD R0, ret+16(FP)\n\tRET\n",
+		"add/data/value.txt": "3\n",
+		"docs/index.html":    "<html></html>\n",
+	})
+
+	// go list runs on the source files only, like in the container
+	listed := t.TempDir()
+	if err := filepath.WalkDir(project, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(project, p)
+		if err != nil {
+			return err
+		}
+		for _, pattern := range goSourcePatterns {
+			if ok, _ := path.Match(strings.TrimPrefix(pattern, "**/"), path.Base(filepath.ToSlash(rel))); ok {
+				copyFile(t, p, filepath.Join(listed, rel))
+				break
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	out := goCommand(t, listed, "amd64", goListFiles()[1:]...)
+	inputs, err := packagesFiles(listed, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"add/add_arm64.s", "add/add_amd64.s", "add/data/*.txt"} {
+		if !contains(inputs, want) {
+			t.Errorf("expected %s in the Go inputs, got %v", want, inputs)
+		}
+	}
+
+	// only the inputs are uploaded, the build must work for all the platforms
+	uploaded := t.TempDir()
+	copyFile(t, filepath.Join(project, "go.mod"), filepath.Join(uploaded, "go.mod"))
+	for _, input := range inputs {
+		matches, err := filepath.Glob(filepath.Join(project, filepath.FromSlash(input)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range matches {
+			rel, err := filepath.Rel(project, m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			copyFile(t, m, filepath.Join(uploaded, rel))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(uploaded, "docs")); err == nil {
+		t.Error("expected the files other than the Go inputs not to be uploaded")
+	}
+	for _, arch := range []string{"amd64", "arm64"} {
+		goCommand(t, uploaded, arch, "build", "-o", filepath.Join(t.TempDir(), "app"), ".")
+	}
+}
+
+func goCommand(t *testing.T, dir, arch string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+arch, "CGO_ENABLED=0", "GOFLAGS=", "GOWORK=off")
+	out, err := cmd.Output()
+	if err != nil {
+		var stderr []byte
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = exitErr.Stderr
+		}
+		t.Fatalf("go %s for %s: %v\n%s", strings.Join(args, " "), arch, err, stderr)
+	}
+	return string(out)
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
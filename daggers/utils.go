@@ -2,32 +2,118 @@ package daggers
 
 import (
 	"context"
+	"os"
+	"strings"
 
 	"dagger.io/dagger"
 
 	"github.com/eunomie/dague"
 	"github.com/eunomie/dague/config"
+	"github.com/eunomie/dague/internal/ui"
+	"github.com/eunomie/dague/internal/workspace"
 )
 
+// secretEnvPrefix prefixes the environment variables used to pass the secrets to the dagger engine. They are hidden
+// from the scripts run on the host, see the shell package.
+const secretEnvPrefix = "DAGUE_SECRET_"
+
 func RunInDagger(ctx context.Context, conf *config.Dague, do func(*Client) error) error {
+	return RunInDaggerWithSecrets(ctx, conf, nil, do)
+}
+
+// RunInDaggerWithSecrets is like RunInDagger, the named secrets being read before connecting to dagger so they can be
+// given to the containers with WithSecrets. Only them, and the token of the private modules, are read.
+func RunInDaggerWithSecrets(ctx context.Context, conf *config.Dague, names []string, do func(*Client) error) error {
+	if err := conf.RenderSection("go"); err != nil {
+		return err
+	}
+	if token := conf.Go.Modules.Private.Token.Secret; token != "" {
+		names = append(names[:len(names):len(names)], token)
+	}
+	secrets, err := conf.SecretValues(ctx, names...)
+	if err != nil {
+		return err
+	}
+	// the secrets are read by the engine from the environment, and masked from all the logs
+	var values []string
+	for name, value := range secrets {
+		if err := os.Setenv(secretEnvPrefix+name, value); err != nil {
+			return err
+		}
+		values = append(values, strings.TrimSpace(value))
+	}
+	ui.Mask(values...)
+	knownHosts, err := preparePrivateModules(conf.Go.Modules.Private, secrets)
+	if err != nil {
+		return err
+	}
+
+	opts, err := sourcesOpts(conf.Go.Sources)
+	if err != nil {
+		return err
+	}
+	modules, err := workspace.Find(".")
+	if err != nil {
+		return err
+	}
+	work, err := workspace.HasWork(".")
+	if err != nil {
+		return err
+	}
+	var requirements []string
+	if work {
+		if requirements, err = workspace.Requirements(".", modules); err != nil {
+			return err
+		}
+	}
+
 	return dague.RunInDagger(ctx, func(client *dagger.Client) error {
 		c := NewClient(client, conf)
+		c.sourcesOpts = opts
+		c.modules = modules
+		c.work = work
+		c.requirements = requirements
+		c.knownHosts = knownHosts
+		if conf.Go.Sources.GoOnly {
+			// the Go inputs are listed from all the sources, then only them are mounted
+			inputs, err := goInputs(ctx, c)
+			if err != nil {
+				return err
+			}
+			c.sourcesOpts.Include = append(append([]string{}, opts.Include...), inputs...)
+		}
 		return do(c)
-	})
+	}, dagger.WithLogOutput(ui.Stderr))
 }
 
-func applyBase(cont *dagger.Container, c *dagger.Client, conf *config.Dague) *dagger.Container {
-	for host, guest := range conf.Go.Image.Mounts {
-		cont = cont.WithMountedDirectory(guest, c.Host().Directory(host))
+func applyBase(cont *dagger.Container, c *Client) *dagger.Container {
+	for host, guest := range c.Config.Go.Image.Mounts {
+		cont = cont.WithMountedDirectory(guest, c.Dagger.Host().Directory(host))
 	}
-	for k, v := range conf.Go.Image.Env {
+	for k, v := range c.Config.Go.Image.Env {
 		cont = cont.WithEnvVariable(k, v)
 	}
 
-	for _, cache := range conf.Go.Image.Caches {
-		cacheVolume := c.CacheVolume(cache.Target)
+	cont = withPrivateModules(cont, c)
+
+	for _, cache := range c.Config.Go.Image.Caches {
+		cacheVolume := c.Dagger.CacheVolume(cache.Target)
 		cont = cont.WithMountedCache(cache.Target, cacheVolume)
 	}
 
 	return cont
 }
+
+// WithSecrets gives the named secrets to the container, as environment variables or files. They must have been read
+// by RunInDaggerWithSecrets.
+func WithSecrets(cont *dagger.Container, c *Client, names []string) *dagger.Container {
+	for _, name := range names {
+		value := c.Dagger.Host().EnvVariable(secretEnvPrefix + name).Secret()
+		if mount := c.Config.Secrets[name].Mount; mount != "" {
+			cont = cont.WithMountedSecret(mount, value)
+		} else {
+			cont = cont.WithSecretVariable(name, value)
+		}
+	}
+	return cont
+}
@@ -6,10 +6,13 @@ require (
 	dagger.io/dagger v0.4.2
 	github.com/AlecAivazis/survey/v2 v2.3.6
 	github.com/docker/cli v20.10.17+incompatible
+	github.com/joho/godotenv v1.5.1
 	github.com/spf13/cobra v1.6.1
+	golang.org/x/mod v0.8.0
 	golang.org/x/sync v0.1.0
 	golang.org/x/term v0.3.0
 	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 	mvdan.cc/sh/v3 v3.6.0
 )
 
@@ -10,13 +10,14 @@ import (
 )
 
 // RunInDagger initialize the dagger client and close it. In between it runs the specified function.
+// The logs are written to the standard error, unless other options are specified.
 // Example:
 //
 //	dague.RunInDagger(ctx, func(c *dagger.Client) error {
 //	    c.Container().From("alpine")
 //	})
-func RunInDagger(ctx context.Context, do func(*dagger.Client) error) error {
-	c, err := dagger.Connect(ctx, dagger.WithLogOutput(os.Stderr))
+func RunInDagger(ctx context.Context, do func(*dagger.Client) error, opts ...dagger.ClientOpt) error {
+	c, err := dagger.Connect(ctx, append([]dagger.ClientOpt{dagger.WithLogOutput(os.Stderr)}, opts...)...)
 	if err != nil {
 		return err
 	}
@@ -57,6 +58,23 @@ func ApkInstall(packages ...string) []string {
 	return append([]string{"apk", "add"}, packages...)
 }
 
+// PackageInstall installs the specified packages with apk on alpine based systems, or apt-get on debian based ones,
+// for the images that can be either.
+// Example:
+//
+//	c.Container().From("golangci/golangci-lint").WithExec(PackageInstall("openssh-client"))
+func PackageInstall(packages ...string) []string {
+	script := `if command -v apk >/dev/null; then
+  apk add "$@"
+elif command -v apt-get >/dev/null; then
+  apt-get update && apt-get install --no-install-recommends -y "$@" && apt-get clean && rm -rf /var/lib/apt/lists/*
+else
+  echo "could not install $*: apk or apt-get is required" >&2
+  exit 1
+fi`
+	return append([]string{"sh", "-c", script, "sh"}, packages...)
+}
+
 // AptInstall runs apt-get to install the specified packages. It updates first, install, then clean and remove apt-get lists.
 // Example:
 //
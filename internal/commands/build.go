@@ -0,0 +1,542 @@
+package commands
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/eunomie/dague/internal/report"
+	"github.com/eunomie/dague/internal/ui"
+
+	"github.com/eunomie/dague/internal/shell"
+
+	"github.com/eunomie/dague/config"
+	"github.com/eunomie/dague/daggers"
+	"github.com/eunomie/dague/types"
+)
+
+const (
+	defaultLocalOutTemplate = "{{.Name}}{{.Ext}}"
+	defaultCrossOutTemplate = "{{.Name}}_{{.OS}}_{{.Arch}}{{with .Variant}}_{{.}}{{end}}{{.Ext}}"
+)
+
+// goBuild is a command to build Go binaries of one or more targets, concurrently and in a single session.
+func (l *List) goBuild(ctx context.Context, args []string, conf *config.Dague, opts map[string]interface{}) error {
+	all := false
+	if v, ok := opts["all"]; ok {
+		if b, ok := v.(bool); ok {
+			all = b
+		}
+	}
+	var reportOpts buildReportOptions
+	if v, ok := opts["report"]; ok {
+		if b, ok := v.(bool); ok {
+			reportOpts.Enable = b
+		}
+	}
+	if v, ok := opts["reportSave"]; ok {
+		if f, ok := v.(string); ok {
+			reportOpts.Save = f
+		}
+	}
+	if v, ok := opts["reportBase"]; ok {
+		if f, ok := v.(string); ok {
+			reportOpts.Base = f
+		}
+	}
+
+	var targetNames []string
+	switch {
+	case all:
+		targetNames = conf.TargetNames()
+	case len(args) == 0:
+		selected, err := ui.MultiSelect("Choose the targets to build:", conf.TargetNames())
+		if err != nil {
+			return fmt.Errorf("could not select the targets to build: %w", err)
+		}
+		targetNames = selected
+	default:
+		targetNames = args
+	}
+	if len(targetNames) == 0 {
+		return fmt.Errorf("no target to build")
+	}
+
+	builds, err := buildsOptions(ctx, conf, targetNames)
+	if err != nil {
+		return err
+	}
+	artifacts, err := runBuilds(ctx, conf, builds)
+	if err != nil {
+		return err
+	}
+
+	if err := printBuildSummary(ui.Stdout, artifacts); err != nil {
+		return err
+	}
+	return buildReport(artifacts, reportOpts)
+}
+
+// buildsOptions computes the options to build each of the targets.
+func buildsOptions(ctx context.Context, conf *config.Dague, targetNames []string) ([]types.CrossBuildOpts, error) {
+	var builds []types.CrossBuildOpts
+	for _, targetName := range targetNames {
+		buildOpts, err := buildOptions(ctx, conf, targetName)
+		if err != nil {
+			return nil, err
+		}
+		builds = append(builds, buildOpts)
+	}
+	return builds, nil
+}
+
+// runBuilds runs the builds concurrently in a single dagger session, sharing the sources.
+func runBuilds(ctx context.Context, conf *config.Dague, builds []types.CrossBuildOpts) ([]types.Artifact, error) {
+	var artifacts []types.Artifact
+	err := daggers.RunInDaggerWithSecrets(ctx, conf, buildSecrets(builds), func(c *daggers.Client) error {
+		var err error
+		artifacts, err = buildAll(ctx, c, builds)
+		return err
+	})
+	return artifacts, err
+}
+
+// buildSecrets returns the names of the secrets used by the builds.
+func buildSecrets(builds []types.CrossBuildOpts) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, b := range builds {
+		for _, name := range b.Secrets {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// buildAll runs the builds concurrently in the dagger session, sharing the sources.
+func buildAll(ctx context.Context, c *daggers.Client, builds []types.CrossBuildOpts) ([]types.Artifact, error) {
+	if err := checkOutFiles(builds); err != nil {
+		return nil, err
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	src := daggers.Sources(c)
+	results := make([][]types.Artifact, len(builds))
+	for i, buildOpts := range builds {
+		i, buildOpts := i, buildOpts
+		g.Go(func() error {
+			var err error
+			if len(buildOpts.Platforms) == 0 {
+				// if platforms is not defined then we admit it's a local build
+				results[i], err = daggers.LocalBuild(ctx, c, src, types.LocalBuildOpts{BuildOpts: buildOpts.BuildOpts})
+			} else {
+				results[i], err = daggers.CrossBuild(ctx, c, src, buildOpts)
+			}
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	var artifacts []types.Artifact
+	for _, r := range results {
+		artifacts = append(artifacts, r...)
+	}
+	return artifacts, nil
+}
+
+// checkOutFiles reports the binaries generated by several builds, as they run concurrently and would overwrite each
+// other.
+func checkOutFiles(builds []types.CrossBuildOpts) error {
+	generated := map[string]string{}
+	for _, b := range builds {
+		files, platforms, err := daggers.OutFiles(b)
+		if err != nil {
+			return fmt.Errorf("target %q: %w", b.Target, err)
+		}
+		for i, f := range files {
+			build := fmt.Sprintf("target %q for %s", b.Target, platforms[i])
+			if other, ok := generated[f]; ok {
+				return fmt.Errorf("%s is generated by %s and %s, change the out or outTemplate of the targets", f, other, build)
+			}
+			generated[f] = build
+		}
+	}
+	return nil
+}
+
+// buildReportOptions configures the report of the build.
+type buildReportOptions struct {
+	Enable bool
+	// Save is the file to save the report to, as JSON.
+	Save string
+	// Base is a previously saved report to compare with.
+	Base string
+}
+
+// buildReport prints the report of the artifacts, compares it with a previous one and saves it, depending on the
+// options.
+func buildReport(artifacts []types.Artifact, opts buildReportOptions) error {
+	if !opts.Enable && opts.Save == "" && opts.Base == "" {
+		return nil
+	}
+	r, err := report.New(artifacts)
+	if err != nil {
+		return err
+	}
+	if opts.Enable {
+		_, _ = fmt.Fprintln(ui.Stdout)
+		r.Print(ui.Stdout)
+	}
+	if opts.Base != "" {
+		base, err := report.Load(opts.Base)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(ui.Stdout)
+		report.Diff(ui.Stdout, base, r)
+	}
+	if opts.Save != "" {
+		return r.Save(opts.Save)
+	}
+	return nil
+}
+
+// buildOptions computes the options to build a target. Without platforms, it's a build for the local platform.
+func buildOptions(ctx context.Context, conf *config.Dague, targetName string) (types.CrossBuildOpts, error) {
+	entry, ok := conf.Go.Build.Targets[targetName]
+	if !ok {
+		return types.CrossBuildOpts{}, fmt.Errorf("could not find the target %q to build", targetName)
+	}
+	if entry.Abstract {
+		return types.CrossBuildOpts{}, fmt.Errorf("target %q is abstract, it can only be extended", targetName)
+	}
+	if err := conf.RenderSection("go", "build", "targets", targetName); err != nil {
+		return types.CrossBuildOpts{}, err
+	}
+	if err := conf.RenderSection("go", "build", "cosign"); err != nil {
+		return types.CrossBuildOpts{}, err
+	}
+	target := conf.Go.Build.Targets[targetName]
+
+	outTemplate := target.OutTemplate
+	if outTemplate == "" {
+		outTemplate = defaultLocalOutTemplate
+		if len(target.Platforms) > 0 {
+			outTemplate = defaultCrossOutTemplate
+		}
+	}
+
+	// only the variables used by the target are resolved, and given to the build with its env
+	values := []string{target.Ldflags, target.Gcflags, target.Asmflags, target.Pgo, target.Sign.Key}
+	for _, v := range target.Env {
+		values = append(values, v)
+	}
+	var names []string
+	if target.VersionPackage != "" {
+		for _, v := range versionVariables {
+			names = append(names, v.value)
+		}
+	}
+	if strings.Contains(outTemplate, "Version") {
+		// .Version is the VERSION variable
+		names = append(names, "VERSION")
+	}
+	env, err := conf.ReferencedVars(values, names...)
+	if err != nil {
+		return types.CrossBuildOpts{}, fmt.Errorf("invalid variables of target %q: %w", targetName, err)
+	}
+
+	for k, v := range target.Env {
+		if strings.HasPrefix(v, "shell ") {
+			shellCmd, err := config.RenderTemplate(strings.TrimPrefix(v, "shell "), env)
+			if err != nil {
+				return types.CrossBuildOpts{}, fmt.Errorf("invalid env %s of target %q: %w", k, targetName, err)
+			}
+			value, err := shell.Interpret(ctx, shellCmd, env)
+			if err != nil {
+				return types.CrossBuildOpts{}, err
+			}
+			env[k] = value
+		} else {
+			value, err := config.Render(v, env)
+			if err != nil {
+				return types.CrossBuildOpts{}, fmt.Errorf("invalid env %s of target %q: %w", k, targetName, err)
+			}
+			env[k] = value
+		}
+	}
+
+	buildFlags, err := goBuildFlags(target, env)
+	if err != nil {
+		return types.CrossBuildOpts{}, fmt.Errorf("invalid build flags for target %q: %w", targetName, err)
+	}
+
+	pgoFlag, pgoProfile, err := pgoOptions(target, env, conf.Go.Image.Src)
+	if err != nil {
+		return types.CrossBuildOpts{}, fmt.Errorf("invalid pgo for target %q: %w", targetName, err)
+	}
+	if pgoFlag != "" {
+		buildFlags = append(buildFlags, pgoFlag)
+	}
+
+	signOpts, err := signOptions(target.Sign, conf.Go.Build.Cosign, env)
+	if err != nil {
+		return types.CrossBuildOpts{}, err
+	}
+
+	cgoOpts, err := cgoOptions(target.Cgo, target.Platforms)
+	if err != nil {
+		return types.CrossBuildOpts{}, fmt.Errorf("invalid cgo for target %q: %w", targetName, err)
+	}
+
+	tmpl, err := template.New(targetName).Parse(outTemplate)
+	if err == nil {
+		// render once to report unknown fields before starting any build
+		err = tmpl.Execute(io.Discard, types.OutTemplateData{})
+	}
+	if err != nil {
+		return types.CrossBuildOpts{}, fmt.Errorf("invalid outTemplate for target %q: %w", targetName, err)
+	}
+
+	var platforms []types.Platform
+	for _, p := range target.Platforms {
+		platform, err := types.ParsePlatform(p)
+		if err != nil {
+			return types.CrossBuildOpts{}, err
+		}
+		platforms = append(platforms, platform)
+	}
+
+	out := target.Out
+	if out == "" {
+		out = "./dist"
+	}
+	return types.CrossBuildOpts{
+		BuildOpts: types.BuildOpts{
+			Target:      targetName,
+			Dir:         out,
+			In:          target.Path,
+			EnvVars:     env,
+			BuildFlags:  buildFlags,
+			Sign:        signOpts,
+			Cgo:         cgoOpts,
+			Buildmode:   target.Buildmode,
+			Pgo:         pgoProfile,
+			Secrets:     target.Secrets,
+			Name:        filepath.Base(target.Path),
+			Version:     env["VERSION"],
+			OutTemplate: tmpl,
+		},
+		Platforms: platforms,
+	}, nil
+}
+
+var (
+	buildmodes = map[string]bool{
+		"default": true, "exe": true, "pie": true, "c-shared": true, "c-archive": true, "plugin": true,
+	}
+	executableBuildmodes = map[string]bool{
+		"": true, "default": true, "exe": true, "pie": true,
+	}
+	modModes = map[string]bool{
+		"readonly": true, "vendor": true, "mod": true,
+	}
+	buildTagRegexp = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+)
+
+// goBuildFlags returns the go build flags of the target. String flags are expanded using the environment.
+func goBuildFlags(target config.Target, env map[string]string) ([]string, error) {
+	var flags []string
+
+	expandedFlags := []struct {
+		name  string
+		value string
+	}{
+		{"ldflags", target.Ldflags},
+		{"gcflags", target.Gcflags},
+		{"asmflags", target.Asmflags},
+	}
+	for _, f := range expandedFlags {
+		value, err := config.Render(f.value, env)
+		if err != nil {
+			return nil, err
+		}
+		if f.name == "ldflags" && target.VersionPackage != "" {
+			value = strings.TrimSpace(value + " " + versionLdflags(target.VersionPackage, env))
+		}
+		if value == "" {
+			continue
+		}
+		flags = append(flags, "-"+f.name+"="+value)
+	}
+
+	if len(target.Tags) > 0 {
+		for _, tag := range target.Tags {
+			if !buildTagRegexp.MatchString(tag) {
+				return nil, fmt.Errorf("invalid build tag %q", tag)
+			}
+		}
+		flags = append(flags, "-tags="+strings.Join(target.Tags, ","))
+	}
+
+	if target.Trimpath {
+		flags = append(flags, "-trimpath")
+	}
+
+	if target.Buildmode != "" {
+		if !buildmodes[target.Buildmode] {
+			return nil, fmt.Errorf("unsupported buildmode %q", target.Buildmode)
+		}
+		flags = append(flags, "-buildmode="+target.Buildmode)
+	}
+	if target.Plugin && !executableBuildmodes[target.Buildmode] {
+		return nil, fmt.Errorf("a docker cli plugin must be an executable, not buildmode %q", target.Buildmode)
+	}
+
+	if target.Mod != "" {
+		if !modModes[target.Mod] {
+			return nil, fmt.Errorf("unsupported mod %q, must be readonly, vendor or mod", target.Mod)
+		}
+		flags = append(flags, "-mod="+target.Mod)
+	}
+
+	return flags, nil
+}
+
+// goImageRegexp matches the official Go images, capturing the major and minor versions of Go, like golang:1.19.4-alpine.
+var goImageRegexp = regexp.MustCompile(`^(?:.*/)?golang:(\d+)\.(\d+)(?:[.-]|$)`)
+
+// pgoOptions returns the -pgo flag of the target for auto and off, or the host path of the profile, mounted in the
+// build container. Profile-guided optimization requires Go 1.20, checked when the image is an official Go image.
+func pgoOptions(target config.Target, env map[string]string, image string) (flag, profile string, err error) {
+	if target.Pgo == "" {
+		return "", "", nil
+	}
+	if m := goImageRegexp.FindStringSubmatch(image); m != nil {
+		major, _ := strconv.Atoi(m[1])
+		minor, _ := strconv.Atoi(m[2])
+		if major == 1 && minor < 20 {
+			return "", "", fmt.Errorf("pgo requires Go 1.20, the image %s is Go %s.%s", image, m[1], m[2])
+		}
+	}
+	pgo, err := config.Render(target.Pgo, env)
+	if err != nil {
+		return "", "", err
+	}
+	if pgo == "auto" || pgo == "off" {
+		return "-pgo=" + pgo, "", nil
+	}
+	if _, err := os.Stat(pgo); err != nil {
+		return "", "", fmt.Errorf("could not read pgo profile: %w", err)
+	}
+	return "", pgo, nil
+}
+
+// versionVariables maps the variables of the version package to the built-in variables injected into them.
+var versionVariables = []struct {
+	name  string
+	value string
+}{
+	{"Version", "VERSION"},
+	{"Commit", "GIT_COMMIT"},
+	{"ShortCommit", "GIT_SHORT_COMMIT"},
+	{"Branch", "GIT_BRANCH"},
+	{"Dirty", "GIT_DIRTY"},
+	{"Date", "BUILD_DATE"},
+}
+
+// versionLdflags returns the -X flags setting the version variables of the package. Variables not declared in the
+// package are ignored by the linker.
+func versionLdflags(pkg string, env map[string]string) string {
+	var flags []string
+	for _, v := range versionVariables {
+		if value, ok := env[v.value]; ok && value != "" {
+			flags = append(flags, fmt.Sprintf("-X '%s.%s=%s'", pkg, v.name, value))
+		}
+	}
+	return strings.Join(flags, " ")
+}
+
+// signOptions returns the options to sign the binaries of a target, or nil if signing is not configured.
+func signOptions(sign config.Sign, cosign config.Cosign, env map[string]string) (*types.SignOpts, error) {
+	if sign.Key == "" {
+		return nil, nil
+	}
+	key, err := config.Render(sign.Key, env)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(key); err != nil {
+		return nil, fmt.Errorf("could not read signing key: %w", err)
+	}
+	passwordEnv := sign.PasswordEnv
+	if passwordEnv == "" {
+		passwordEnv = "COSIGN_PASSWORD"
+	}
+	if _, ok := os.LookupEnv(passwordEnv); !ok {
+		return nil, fmt.Errorf("environment variable %s must be set with the password of the signing key", passwordEnv)
+	}
+	return &types.SignOpts{
+		Image:       cosign.Image,
+		Key:         key,
+		PasswordEnv: passwordEnv,
+		Bundle:      sign.Bundle,
+	}, nil
+}
+
+// cgoOptions returns the options to provision a C cross toolchain, or nil if cgo is not enabled.
+func cgoOptions(cgo config.Cgo, platforms []string) (*types.CgoOpts, error) {
+	if !cgo.Enable {
+		return nil, nil
+	}
+	if err := cgo.Check(platforms); err != nil {
+		return nil, err
+	}
+	return &types.CgoOpts{
+		Static: cgo.Static,
+		Cflags: cgo.Cflags,
+	}, nil
+}
+
+// printBuildSummary prints the path, platform, size and sha256 digest of each artifact.
+func printBuildSummary(w io.Writer, artifacts []types.Artifact) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ARTIFACT\tPLATFORM\tSIZE\tSHA256")
+	for _, a := range artifacts {
+		digest, size, err := sha256File(a.Path)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", a.Path, a.Platform, report.HumanSize(size), digest)
+	}
+	return tw.Flush()
+}
+
+// sha256File returns the hex encoded sha256 digest and the size of the file.
+func sha256File(file string) (string, int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eunomie/dague/config"
+)
+
+func TestBuildOptionsUnreferencedVars(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	conf := &config.Dague{
+		Vars: map[string]string{
+			"UNUSED": "shell touch " + marker,
+			"FLAGS":  "shell echo -s -w",
+			"MODE":   "release",
+		},
+		Go: config.Go{Build: config.Build{Targets: map[string]config.Target{
+			"local": {
+				Path:    "./cmd/dague",
+				Ldflags: "${FLAGS}",
+				Env:     map[string]string{"BUILD_MODE": "{{ .MODE }}"},
+			},
+		}}},
+	}
+	opts, err := buildOptions(context.Background(), conf, "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("the unreferenced UNUSED variable must not be run")
+	}
+	if _, ok := opts.EnvVars["UNUSED"]; ok {
+		t.Error("the unreferenced UNUSED variable must not be given to the build")
+	}
+	if opts.EnvVars["BUILD_MODE"] != "release" || opts.EnvVars["FLAGS"] != "-s -w" {
+		t.Errorf("expected the env and the referenced variables, got %v", opts.EnvVars)
+	}
+}
+
+func TestBuildOptionsCgoDarwin(t *testing.T) {
+	conf := &config.Dague{
+		Go: config.Go{Build: config.Build{Targets: map[string]config.Target{
+			"cross": {
+				Path:      "./cmd/dague",
+				Cgo:       config.Cgo{Enable: true},
+				Platforms: []string{"linux/amd64", "darwin/arm64"},
+			},
+		}}},
+	}
+	_, err := buildOptions(context.Background(), conf, "cross")
+	if err == nil || !strings.Contains(err.Error(), "macOS SDK") {
+		t.Errorf("expected darwin to be rejected with cgo, got %v", err)
+	}
+}
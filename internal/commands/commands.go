@@ -3,7 +3,7 @@ package commands
 import (
 	"context"
 	"fmt"
-	"os"
+	"sort"
 	"strings"
 
 	"github.com/eunomie/dague/internal/ui"
@@ -35,13 +35,31 @@ func NewList() *List {
 	l.register("go:test", l.goTest)
 	l.register("go:doc", l.goDoc)
 	l.register("go:build", l.goBuild)
+	l.register("go:install", l.goInstall)
 
 	l.register("go:exec", l.goExec)
 
+	l.register("release:bump", l.releaseBump)
+	l.register("go:release", l.goRelease)
+
 	l.register("task", l.task)
+
+	l.register("config:validate", l.configValidate)
+	l.register("config:schema", l.configSchema)
+	l.register("init", l.configInit)
 	return l
 }
 
+// Names returns the sorted names of the registered commands.
+func (l *List) Names() []string {
+	var names []string
+	for name := range l.cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (l *List) register(name string, runnable Runnable) {
 	l.cmds[name] = runnable
 }
@@ -52,7 +70,7 @@ func (l *List) Run(ctx context.Context, name string, args []string, conf *config
 		return fmt.Errorf("not implemented")
 	}
 
-	_, _ = ui.Blue.Fprintf(os.Stderr, "%s %s\n", name, strings.Join(args, " "))
+	_, _ = ui.Blue.Fprintf(ui.Stderr, "%s %s\n", name, strings.Join(args, " "))
 
 	return r(ctx, args, conf, opts)
 }
@@ -66,14 +84,14 @@ func (l *List) RunDeps(ctx context.Context, deps []string, conf *config.Dague) e
 			return fmt.Errorf("not implemented")
 		}
 
-		_, _ = ui.Purple.Fprintf(os.Stderr, "[-->] %s %s\n", name, strings.Join(args, " "))
+		_, _ = ui.Purple.Fprintf(ui.Stderr, "[-->] %s %s\n", name, strings.Join(args, " "))
 
 		err := r(ctx, args, conf, nil)
 		if err != nil {
 			return err
 		}
 
-		_, _ = ui.Purple.Fprintf(os.Stderr, "[<--] %s %s\n", name, strings.Join(args, " "))
+		_, _ = ui.Purple.Fprintf(ui.Stderr, "[<--] %s %s\n", name, strings.Join(args, " "))
 	}
 	return nil
 }
@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/eunomie/dague/internal/ui"
+
+	"github.com/eunomie/dague/config"
+)
+
+// configValidate is a command checking the configuration, loaded without the strict mode: it reports the unknown and
+// duplicated keys, renders all the sections and checks the platforms, the dependencies, the commands to run and the
+// exports, all at once.
+func (l *List) configValidate(_ context.Context, _ []string, conf *config.Dague, _ map[string]interface{}) error {
+	if err := conf.Validate(l.Names()); err != nil {
+		return err
+	}
+	_, _ = ui.Green.Fprintln(ui.Stderr, "configuration is valid")
+	return nil
+}
+
+// configSchema is a command printing the JSON Schema of the configuration file.
+func (l *List) configSchema(_ context.Context, _ []string, _ *config.Dague, _ map[string]interface{}) error {
+	schema, err := config.Schema()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(ui.Stdout, string(schema))
+	return err
+}
@@ -3,18 +3,13 @@ package commands
 import (
 	"context"
 	"fmt"
-	"path/filepath"
-	"strings"
 
 	"github.com/eunomie/dague/internal/ui"
 
-	"github.com/eunomie/dague/internal/shell"
-
 	"github.com/eunomie/dague"
 
 	"github.com/eunomie/dague/config"
 	"github.com/eunomie/dague/daggers"
-	"github.com/eunomie/dague/types"
 )
 
 // goModDownload is a command to download go modules.
@@ -25,24 +20,21 @@ func (l *List) goModDownload(ctx context.Context, _ []string, conf *config.Dague
 	})
 }
 
-// goMod is a command to run go mod tidy and export go.mod and go.sum files.
-func (l *List) goMod(ctx context.Context, _ []string, conf *config.Dague, _ map[string]interface{}) error {
-	return daggers.RunInDagger(ctx, conf, func(c *daggers.Client) error {
-		if err := daggers.ExportGoMod(ctx, c); err != nil {
-			return err
-		}
-		return nil
+// goMod is a command to run go mod tidy and export go.mod and go.sum files, for each module.
+func (l *List) goMod(ctx context.Context, _ []string, conf *config.Dague, opts map[string]interface{}) error {
+	return forEachModule(ctx, conf, opts, func(c *daggers.Client, dir string) error {
+		return daggers.ExportGoMod(ctx, c, dir)
 	})
 }
 
-// goTest is a command running Go tests.
-func (l *List) goTest(ctx context.Context, _ []string, conf *config.Dague, _ map[string]interface{}) error {
-	return daggers.RunInDagger(ctx, conf, func(c *daggers.Client) error {
-		return daggers.RunGoTests(ctx, c)
+// goTest is a command running Go tests, for each module.
+func (l *List) goTest(ctx context.Context, _ []string, conf *config.Dague, opts map[string]interface{}) error {
+	return forEachModule(ctx, conf, opts, func(c *daggers.Client, dir string) error {
+		return daggers.RunGoTests(ctx, c, dir)
 	})
 }
 
-// goDoc is a command generating Go documentation into readme.md files.
+// goDoc is a command generating Go documentation into readme.md files, for each module.
 func (l *List) goDoc(ctx context.Context, _ []string, conf *config.Dague, opts map[string]interface{}) error {
 	check := false
 	if v, ok := opts["check"]; ok {
@@ -50,22 +42,28 @@ func (l *List) goDoc(ctx context.Context, _ []string, conf *config.Dague, opts m
 			check = b
 		}
 	}
+	if check {
+		return forEachModule(ctx, conf, opts, func(c *daggers.Client, dir string) error {
+			return daggers.CheckGoDoc(ctx, c, dir)
+		})
+	}
+	modules, err := selectModules(opts)
+	if err != nil {
+		return err
+	}
+	var dirs []string
+	for _, m := range modules {
+		dirs = append(dirs, m.Dir)
+	}
 	return daggers.RunInDagger(ctx, conf, func(c *daggers.Client) error {
-		if check {
-			return daggers.CheckGoDoc(ctx, c)
-		}
-		return daggers.GoDoc(ctx, c)
+		return daggers.GoDoc(ctx, c, dirs)
 	})
 }
 
 func (l *List) goExec(ctx context.Context, args []string, conf *config.Dague, _ map[string]interface{}) error {
 	var execName string
 	if len(args) == 0 {
-		var execNames []string
-		for k := range conf.Go.Exec {
-			execNames = append(execNames, k)
-		}
-		selected, err := ui.Select("Choose the task to run inside the build container:", execNames)
+		selected, err := ui.Select("Choose the task to run inside the build container:", conf.ExecNames())
 		if err != nil {
 			return fmt.Errorf("could not select the target to run: %w", err)
 		}
@@ -74,101 +72,46 @@ func (l *List) goExec(ctx context.Context, args []string, conf *config.Dague, _
 		execName = args[0]
 	}
 
-	exec, ok := conf.Go.Exec[execName]
+	entry, ok := conf.Go.Exec[execName]
 	if !ok {
 		return fmt.Errorf("could not find the target %q to run", execName)
 	}
+	if entry.Abstract {
+		return fmt.Errorf("exec %q is abstract, it can only be extended", execName)
+	}
+	if err := conf.RenderSection("go", "exec", execName); err != nil {
+		return err
+	}
+	exec := conf.Go.Exec[execName]
 
 	if err := l.RunDeps(ctx, exec.Deps, conf); err != nil {
 		return err
 	}
 
-	return daggers.RunInDagger(ctx, conf, func(c *daggers.Client) error {
+	env, err := execEnv(conf, execName)
+	if err != nil {
+		return err
+	}
+
+	return daggers.RunInDaggerWithSecrets(ctx, conf, exec.Secrets, func(c *daggers.Client) error {
 		cmdArgs := []string{"sh", "-c", exec.Cmds}
+		cont := daggers.WithSecrets(daggers.Sources(c), c, exec.Secrets)
+		for k, v := range env {
+			cont = cont.WithEnvVariable(k, v)
+		}
 		if exec.Export.Path != "" && exec.Export.Pattern != "" {
-			return dague.ExportFilePattern(ctx, daggers.Sources(c).WithExec(cmdArgs), exec.Export.Pattern, exec.Export.Path)
+			return dague.ExportFilePattern(ctx, cont.WithExec(cmdArgs), exec.Export.Pattern, exec.Export.Path)
 		}
-		return dague.Exec(ctx, daggers.Sources(c), cmdArgs)
+		return dague.Exec(ctx, cont, cmdArgs)
 	})
 }
 
-// goBuild is a command to build a Go binary based on the local architecture.
-func (l *List) goBuild(ctx context.Context, args []string, conf *config.Dague, _ map[string]interface{}) error {
-	var targetName string
-
-	if len(args) == 0 {
-		var targetNames []string
-		for k := range conf.Go.Build.Targets {
-			targetNames = append(targetNames, k)
-		}
-		selected, err := ui.Select("Choose the target to build:", targetNames)
-		if err != nil {
-			return fmt.Errorf("could not select the target to build: %w", err)
-		}
-		targetName = selected
-	} else {
-		targetName = args[0]
-	}
-
-	target, ok := conf.Go.Build.Targets[targetName]
-	if !ok {
-		return fmt.Errorf("could not find the target %q to build", targetName)
-	}
-
-	env := conf.VarsDup()
-
-	for k, v := range target.Env {
-		if strings.HasPrefix(v, "shell ") {
-			shellCmd := strings.TrimPrefix(v, "shell ")
-			value, err := shell.Interpret(ctx, shellCmd, env)
-			if err != nil {
-				return err
-			}
-			env[k] = value
-		} else {
-			env[k] = v
-		}
+// execEnv returns the variables used by the script of the exec, set in the environment of the container as its shell
+// expands them.
+func execEnv(conf *config.Dague, execName string) (map[string]string, error) {
+	env, err := conf.ScriptVars(conf.Go.Exec[execName].Cmds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid variables of exec %q: %w", execName, err)
 	}
-
-	var buildFlags []string
-	if target.Ldflags != "" {
-		flags, err := shell.Expand(target.Ldflags, env)
-		if err != nil {
-			return err
-		}
-		buildFlags = append(buildFlags, "-ldflags="+flags)
-	}
-	return daggers.RunInDagger(ctx, conf, func(c *daggers.Client) error {
-		out := target.Out
-		if out == "" {
-			out = "./dist"
-		}
-		if len(target.Platforms) == 0 {
-			// if platforms is not defined then we admit it's a local build
-			return daggers.LocalBuild(ctx, c, types.LocalBuildOpts{
-				BuildOpts: types.BuildOpts{
-					Dir:        out,
-					In:         target.Path,
-					EnvVars:    env,
-					BuildFlags: buildFlags,
-				},
-				Out: filepath.Base(target.Path),
-			})
-		}
-		var platforms []types.Platform
-		for _, p := range target.Platforms {
-			t := strings.SplitN(p, "/", 2)
-			platforms = append(platforms, types.Platform{OS: t[0], Arch: t[1]})
-		}
-		return daggers.CrossBuild(ctx, c, types.CrossBuildOpts{
-			BuildOpts: types.BuildOpts{
-				Dir:        out,
-				In:         target.Path,
-				EnvVars:    env,
-				BuildFlags: buildFlags,
-			},
-			OutFileFormat: filepath.Base(target.Path) + "_%s_%s",
-			Platforms:     platforms,
-		})
-	})
+	return env, nil
 }
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eunomie/dague/config"
+)
+
+func TestExecEnv(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	conf := &config.Dague{
+		Vars: map[string]string{
+			"VERSION": "shell echo 1.2.3",
+			"UNUSED":  "shell touch " + marker,
+		},
+		Go: config.Go{Exec: map[string]config.Exec{
+			"print": {Cmds: `echo "version ${VERSION}"`},
+		}},
+	}
+	env, err := execEnv(conf, "print")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("the unreferenced UNUSED variable must not be run")
+	}
+
+	// the script is run by sh in the container, with the env set
+	cmd := exec.Command("sh", "-c", conf.Go.Exec["print"].Cmds)
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH")}
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "version 1.2.3" {
+		t.Errorf("expected the script to expand VERSION, got %q", got)
+	}
+}
@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/eunomie/dague/internal/scaffold"
+	"github.com/eunomie/dague/internal/ui"
+
+	"github.com/eunomie/dague/config"
+)
+
+const configFile = ".dague.yml"
+
+// configInit is a command inspecting the project to write a commented .dague.yml file, with a target for each main
+// package.
+func (l *List) configInit(_ context.Context, _ []string, _ *config.Dague, opts map[string]interface{}) error {
+	force := false
+	if v, ok := opts["force"]; ok {
+		if b, ok := v.(bool); ok {
+			force = b
+		}
+	}
+	if _, err := os.Stat(configFile); err == nil && !force {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", configFile)
+	}
+
+	project, err := scaffold.Inspect(".")
+	if err != nil {
+		return fmt.Errorf("could not inspect the project: %w", err)
+	}
+	content, err := scaffold.Render(project)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(configFile, content, 0o644); err != nil {
+		return err
+	}
+	_, _ = ui.Green.Fprintf(ui.Stderr, "%s written with %d build target(s)\n", configFile, len(project.Mains))
+	return nil
+}
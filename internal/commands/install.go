@@ -0,0 +1,135 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/docker/cli/cli-plugins/manager"
+	dockerconfig "github.com/docker/cli/cli/config"
+
+	"github.com/eunomie/dague/internal/ui"
+
+	"github.com/eunomie/dague/config"
+)
+
+// pluginNameRegexp is the format of the plugin names accepted by the docker cli.
+var pluginNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// goInstall is a command building a target for the host platform and installing it. Docker cli plugins are installed
+// in the cli-plugins directory of the docker config, other binaries in GOBIN.
+func (l *List) goInstall(ctx context.Context, args []string, conf *config.Dague, _ map[string]interface{}) error {
+	var targetName string
+	if len(args) == 0 {
+		selected, err := ui.Select("Choose the target to install:", conf.TargetNames())
+		if err != nil {
+			return fmt.Errorf("could not select the target to install: %w", err)
+		}
+		targetName = selected
+	} else {
+		targetName = args[0]
+	}
+
+	builds, err := buildsOptions(ctx, conf, []string{targetName})
+	if err != nil {
+		return err
+	}
+	// always build for the host platform
+	builds[0].Platforms = nil
+	artifacts, err := runBuilds(ctx, conf, builds)
+	if err != nil {
+		return err
+	}
+	if len(artifacts) != 1 {
+		return fmt.Errorf("expected one binary for target %q, got %d", targetName, len(artifacts))
+	}
+	artifact := artifacts[0]
+	name := builds[0].Name + artifact.Platform.Ext()
+
+	dir := goBin()
+	if conf.Go.Build.Targets[targetName].Plugin {
+		if err := checkPlugin(ctx, artifact.Path, name); err != nil {
+			return err
+		}
+		dir = filepath.Join(dockerconfig.Dir(), "cli-plugins")
+	}
+
+	dest := filepath.Join(dir, name)
+	if err := installFile(artifact.Path, dest); err != nil {
+		return fmt.Errorf("could not install %s: %w", dest, err)
+	}
+	_, _ = ui.Green.Fprintf(ui.Stderr, "%s installed to %s\n", targetName, dest)
+	return nil
+}
+
+// goBin returns the directory where go install puts the binaries.
+func goBin() string {
+	if gobin := os.Getenv("GOBIN"); gobin != "" {
+		return gobin
+	}
+	return filepath.Join(filepath.SplitList(build.Default.GOPATH)[0], "bin")
+}
+
+// checkPlugin runs the plugin metadata handshake of the docker cli against the binary, and checks the binary name.
+func checkPlugin(ctx context.Context, file, name string) error {
+	pluginName := strings.TrimSuffix(name, filepath.Ext(name))
+	if !strings.HasPrefix(pluginName, manager.NamePrefix) {
+		return fmt.Errorf("docker cli plugin %q must be named with the %q prefix", pluginName, manager.NamePrefix)
+	}
+	if !pluginNameRegexp.MatchString(strings.TrimPrefix(pluginName, manager.NamePrefix)) {
+		return fmt.Errorf("docker cli plugin name %q must match %s after the prefix", pluginName, pluginNameRegexp)
+	}
+
+	out, err := exec.CommandContext(ctx, file, manager.MetadataSubcommandName).Output()
+	if err != nil {
+		return fmt.Errorf("%s does not answer the %s command: %w", file, manager.MetadataSubcommandName, err)
+	}
+	var meta manager.Metadata
+	if err := json.Unmarshal(out, &meta); err != nil {
+		return fmt.Errorf("invalid docker cli plugin metadata of %s: %w", file, err)
+	}
+	if meta.SchemaVersion != "0.1.0" {
+		return fmt.Errorf("docker cli plugin SchemaVersion %q of %s is not valid, must be 0.1.0", meta.SchemaVersion, file)
+	}
+	if meta.Vendor == "" {
+		return fmt.Errorf("docker cli plugin metadata of %s does not define a vendor", file)
+	}
+	return nil
+}
+
+// installFile copies the file as an executable. It's written next to the destination then renamed, so a running
+// binary, like dague itself, can be replaced.
+func installFile(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
@@ -8,35 +8,35 @@ import (
 	"github.com/eunomie/dague/daggers"
 )
 
-func (l *List) goLint(ctx context.Context, _ []string, conf *config.Dague, _ map[string]interface{}) error {
-	return daggers.RunInDagger(ctx, conf, func(c *daggers.Client) error {
+func (l *List) goLint(ctx context.Context, _ []string, conf *config.Dague, opts map[string]interface{}) error {
+	return forEachModule(ctx, conf, opts, func(c *daggers.Client, dir string) error {
 		if conf.Go.Lint.Govulncheck.Enable {
-			err := daggers.GoVulnCheck(ctx, c)
+			err := daggers.GoVulnCheck(ctx, c, dir)
 			if err != nil {
 				return err
 			}
 		}
 		if conf.Go.Lint.Golangci.Enable {
-			return daggers.GolangCILint(ctx, c)
+			return daggers.GolangCILint(ctx, c, dir)
 		}
 		return nil
 	})
 }
 
-func (l *List) goLintGovuln(ctx context.Context, _ []string, conf *config.Dague, _ map[string]interface{}) error {
-	return daggers.RunInDagger(ctx, conf, func(c *daggers.Client) error {
-		if !conf.Go.Lint.Govulncheck.Enable {
-			return fmt.Errorf("govulncheck must be enabled")
-		}
-		return daggers.GoVulnCheck(ctx, c)
+func (l *List) goLintGovuln(ctx context.Context, _ []string, conf *config.Dague, opts map[string]interface{}) error {
+	if !conf.Go.Lint.Govulncheck.Enable {
+		return fmt.Errorf("govulncheck must be enabled")
+	}
+	return forEachModule(ctx, conf, opts, func(c *daggers.Client, dir string) error {
+		return daggers.GoVulnCheck(ctx, c, dir)
 	})
 }
 
-func (l *List) goLintGolangCILint(ctx context.Context, _ []string, conf *config.Dague, _ map[string]interface{}) error {
-	return daggers.RunInDagger(ctx, conf, func(c *daggers.Client) error {
-		if !conf.Go.Lint.Golangci.Enable {
-			return fmt.Errorf("golangci-lint must be enabled")
-		}
-		return daggers.GolangCILint(ctx, c)
+func (l *List) goLintGolangCILint(ctx context.Context, _ []string, conf *config.Dague, opts map[string]interface{}) error {
+	if !conf.Go.Lint.Golangci.Enable {
+		return fmt.Errorf("golangci-lint must be enabled")
+	}
+	return forEachModule(ctx, conf, opts, func(c *daggers.Client, dir string) error {
+		return daggers.GolangCILint(ctx, c, dir)
 	})
 }
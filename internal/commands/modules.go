@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/eunomie/dague/config"
+	"github.com/eunomie/dague/daggers"
+	"github.com/eunomie/dague/internal/ui"
+	"github.com/eunomie/dague/internal/workspace"
+)
+
+// selectModules returns the modules of the project selected with the modules option, all of them by default.
+func selectModules(opts map[string]interface{}) ([]workspace.Module, error) {
+	modules, err := workspace.Find(".")
+	if err != nil {
+		return nil, fmt.Errorf("could not find the Go modules: %w", err)
+	}
+	names, _ := opts["modules"].([]string)
+	return workspace.Select(modules, names)
+}
+
+// forEachModule runs the function on each selected module. With several modules, all of them are run even if one
+// fails, then the result of each module is printed.
+func forEachModule(ctx context.Context, conf *config.Dague, opts map[string]interface{}, do func(c *daggers.Client, dir string) error) error {
+	modules, err := selectModules(opts)
+	if err != nil {
+		return err
+	}
+	return daggers.RunInDagger(ctx, conf, func(c *daggers.Client) error {
+		if len(modules) == 1 {
+			return do(c, modules[0].Dir)
+		}
+
+		errs := make([]error, len(modules))
+		for i, m := range modules {
+			_, _ = ui.Purple.Fprintf(ui.Stderr, "[module] %s\n", m.Dir)
+			errs[i] = do(c, m.Dir)
+		}
+
+		var failed []string
+		for i, m := range modules {
+			if errs[i] != nil {
+				_, _ = ui.Red.Fprintf(ui.Stderr, "FAIL %s: %s\n", m.Dir, errs[i])
+				failed = append(failed, m.Dir)
+				continue
+			}
+			_, _ = ui.Green.Fprintf(ui.Stderr, "ok   %s\n", m.Dir)
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("failed for %d of %d modules: %s", len(failed), len(modules), strings.Join(failed, ", "))
+		}
+		return nil
+	})
+}
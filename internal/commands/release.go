@@ -0,0 +1,269 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/eunomie/dague/internal/git"
+	"github.com/eunomie/dague/internal/release"
+	"github.com/eunomie/dague/internal/report"
+	"github.com/eunomie/dague/internal/semver"
+	"github.com/eunomie/dague/internal/ui"
+	"github.com/eunomie/dague/types"
+
+	"github.com/eunomie/dague/config"
+	"github.com/eunomie/dague/daggers"
+)
+
+// releaseBump is a command computing the next version from the tags and the conventional commits since the last tag.
+// It commits the updated changelog, tags this commit and updates the version variables for the next commands. The
+// working tree must be clean.
+func (l *List) releaseBump(ctx context.Context, args []string, conf *config.Dague, opts map[string]interface{}) error {
+	dryRun := false
+	if v, ok := opts["dryRun"]; ok {
+		if b, ok := v.(bool); ok {
+			dryRun = b
+		}
+	}
+	bump := "auto"
+	if len(args) > 0 {
+		bump = args[0]
+	}
+
+	repo, err := git.Open(".")
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	version, err := repo.Version()
+	if err != nil {
+		return err
+	}
+	if version.Dirty && !dryRun {
+		return errors.New("the working tree has uncommitted changes, commit or stash them before release:bump")
+	}
+
+	var (
+		current semver.Version
+		since   *git.Hash
+		prefix  = "v"
+	)
+	if version.Tag != "" {
+		tags, err := repo.Tags()
+		if err != nil {
+			return err
+		}
+		tagged := tags[version.Tag]
+		since = &tagged
+		if current, err = semver.Parse(version.Tag); err != nil {
+			return err
+		}
+		if !strings.HasPrefix(version.Tag, "v") {
+			prefix = ""
+		}
+	}
+
+	commits, err := repo.CommitsSince(since)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return fmt.Errorf("nothing to release, no commit since %s", version.Tag)
+	}
+	var changes []release.Change
+	for _, c := range commits {
+		change := release.ParseCommit(c)
+		if change.Type == release.CommitType && change.Scope == release.CommitScope {
+			// the changelog commits of the previous releases
+			continue
+		}
+		changes = append(changes, change)
+	}
+
+	next, err := release.NextVersion(current, bump, changes)
+	if err != nil {
+		return err
+	}
+	tag := prefix + next.String()
+	section := release.Changelog(next.String(), time.Now(), changes)
+
+	_, _ = ui.Green.Fprintf(ui.Stderr, "%s -> %s\n", orDefault(version.Tag, "none"), tag)
+	_, _ = fmt.Fprint(ui.Stdout, section)
+	if dryRun {
+		return nil
+	}
+
+	if err := conf.RenderSection("go", "release"); err != nil {
+		return err
+	}
+	if err := release.CheckGit(); err != nil {
+		return err
+	}
+	if changelog := conf.Go.Release.Changelog; changelog != "" {
+		if err := release.PrependChangelog(changelog, section); err != nil {
+			return fmt.Errorf("could not update changelog: %w", err)
+		}
+		message := fmt.Sprintf("%s(%s): %s", release.CommitType, release.CommitScope, tag)
+		if err := release.CommitChangelog(ctx, changelog, message); err != nil {
+			return fmt.Errorf("could not commit changelog: %w", err)
+		}
+	}
+	if err := release.CreateTag(ctx, tag, section); err != nil {
+		return fmt.Errorf("could not create tag %s: %w", tag, err)
+	}
+
+	// next commands, like go:build in the same task, use the released version
+	conf.SetVar("VERSION", next.String())
+	conf.SetVar("GIT_TAG", tag)
+	return nil
+}
+
+// goRelease is a command building a target and writing the checksums of the binaries, signed like the binaries when
+// the target has a signing key. The configured publishers, like
+// the Homebrew formula or the Scoop manifest, are then rendered with the download URLs and the digests.
+func (l *List) goRelease(ctx context.Context, args []string, conf *config.Dague, _ map[string]interface{}) error {
+	var targetName string
+	if len(args) == 0 {
+		selected, err := ui.Select("Choose the target to release:", conf.TargetNames())
+		if err != nil {
+			return fmt.Errorf("could not select the target to release: %w", err)
+		}
+		targetName = selected
+	} else {
+		targetName = args[0]
+	}
+
+	builds, err := buildsOptions(ctx, conf, []string{targetName})
+	if err != nil {
+		return err
+	}
+	var (
+		artifacts []types.Artifact
+		files     []release.File
+		checksums string
+	)
+	err = daggers.RunInDaggerWithSecrets(ctx, conf, buildSecrets(builds), func(c *daggers.Client) error {
+		if artifacts, err = buildAll(ctx, c, builds); err != nil {
+			return err
+		}
+		if len(artifacts) == 0 {
+			return fmt.Errorf("nothing to release for target %q", targetName)
+		}
+		for _, a := range artifacts {
+			digest, _, err := sha256File(a.Path)
+			if err != nil {
+				return err
+			}
+			files = append(files, release.File{
+				File:    filepath.Base(a.Path),
+				OS:      a.Platform.OS,
+				Arch:    a.Platform.Arch,
+				Variant: a.Platform.Variant,
+				SHA256:  digest,
+			})
+		}
+		checksums = filepath.Join(filepath.Dir(artifacts[0].Path), "checksums.txt")
+		if err := release.WriteChecksums(checksums, files); err != nil {
+			return fmt.Errorf("could not write checksums: %w", err)
+		}
+		// the checksums are signed like the binaries of the target
+		if sign := builds[0].Sign; sign != nil {
+			if err := daggers.SignFile(ctx, c, checksums, sign); err != nil {
+				return fmt.Errorf("could not sign checksums: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := printBuildSummary(ui.Stdout, artifacts); err != nil {
+		return err
+	}
+	_, _ = ui.Green.Fprintf(ui.Stderr, "checksums written to %s\n", checksums)
+
+	version, err := conf.Var("VERSION")
+	if err != nil {
+		return err
+	}
+	tag, err := conf.Var("GIT_TAG")
+	if err != nil {
+		return err
+	}
+	tag = orDefault(tag, version)
+
+	manifest := filepath.Join(filepath.Dir(checksums), "release.json")
+	if err := writeReleaseManifest(manifest, version, tag, artifacts, files); err != nil {
+		return fmt.Errorf("could not write release manifest: %w", err)
+	}
+	_, _ = ui.Green.Fprintf(ui.Stderr, "release manifest written to %s\n", manifest)
+
+	return publish(conf, targetName, version, tag, files)
+}
+
+// writeReleaseManifest writes the release.json manifest: the version, and the report of the artifacts with their
+// digests. It can be given to --report-base to compare a build with the release.
+func writeReleaseManifest(file, version, tag string, artifacts []types.Artifact, files []release.File) error {
+	r, err := report.New(artifacts)
+	if err != nil {
+		return err
+	}
+	// the files are in the order of the artifacts
+	for i := range r.Artifacts {
+		r.Artifacts[i].SHA256 = files[i].SHA256
+	}
+	return report.Release{Version: version, Tag: tag, Report: r}.Save(file)
+}
+
+// publish renders the publishers having an output file.
+func publish(conf *config.Dague, targetName, version, tag string, files []release.File) error {
+	if err := conf.RenderSection("go", "release"); err != nil {
+		return err
+	}
+	publishers := conf.Go.Release.Publishers
+
+	all := map[string]config.Publisher{release.Homebrew: publishers.Homebrew, release.Scoop: publishers.Scoop}
+	for _, name := range []string{release.Homebrew, release.Scoop} {
+		publisher := all[name]
+		if publisher.Output == "" {
+			continue
+		}
+		if publishers.URL == "" {
+			return fmt.Errorf("go.release.publishers.url is required to publish a %s file", name)
+		}
+		urlTmpl, err := release.URLTemplate(publishers.URL)
+		if err != nil {
+			return err
+		}
+		p := release.Publication{
+			Name:        orDefault(publisher.Name, filepath.Base(conf.Go.Build.Targets[targetName].Path)),
+			Description: publisher.Description,
+			Homepage:    publisher.Homepage,
+			License:     publisher.License,
+			Version:     version,
+			Tag:         tag,
+		}
+		for _, f := range files {
+			if f.URL, err = release.URL(urlTmpl, version, tag, f); err != nil {
+				return fmt.Errorf("could not render the url of %s: %w", f.File, err)
+			}
+			p.All = append(p.All, f)
+		}
+		if err := release.Publish(name, publisher.Template, publisher.Output, p); err != nil {
+			return err
+		}
+		_, _ = ui.Green.Fprintf(ui.Stderr, "%s written to %s\n", name, publisher.Output)
+	}
+	return nil
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -14,11 +14,7 @@ import (
 func (l *List) task(ctx context.Context, args []string, conf *config.Dague, _ map[string]interface{}) error {
 	var taskName string
 	if len(args) == 0 {
-		var taskNames []string
-		for k := range conf.Tasks {
-			taskNames = append(taskNames, k)
-		}
-		selected, err := ui.Select("Choose the task to run:", taskNames)
+		selected, err := ui.Select("Choose the task to run:", conf.TaskNames())
 		if err != nil {
 			return fmt.Errorf("could not select the task to run: %w", err)
 		}
@@ -27,10 +23,17 @@ func (l *List) task(ctx context.Context, args []string, conf *config.Dague, _ ma
 		taskName = args[0]
 	}
 
-	task, ok := conf.Tasks[taskName]
+	entry, ok := conf.Tasks[taskName]
 	if !ok {
 		return fmt.Errorf("could not find the task %q to run", taskName)
 	}
+	if entry.Abstract {
+		return fmt.Errorf("task %q is abstract, it can only be extended", taskName)
+	}
+	if err := conf.RenderSection("tasks", taskName); err != nil {
+		return err
+	}
+	task := conf.Tasks[taskName]
 
 	if err := l.RunDeps(ctx, task.Deps, conf); err != nil {
 		return err
@@ -39,5 +42,10 @@ func (l *List) task(ctx context.Context, args []string, conf *config.Dague, _ ma
 	if task.Cmds == "" {
 		return nil
 	}
-	return shell.Run(ctx, task.Cmds, conf.Vars)
+	// only the variables used by the script are resolved, and exported to the programs it runs
+	vars, err := conf.ScriptVars(task.Cmds)
+	if err != nil {
+		return err
+	}
+	return shell.Run(ctx, task.Cmds, vars)
 }
@@ -0,0 +1,181 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// attrSet and attrUnset are the values of the attributes set, like text, or unset, like -text. Other values are the
+// ones assigned, like eol=crlf.
+const (
+	attrSet   = "\x00set"
+	attrUnset = "\x00unset"
+)
+
+// attrAssign is the assignment of an attribute. An empty value makes the attribute unspecified, like !text.
+type attrAssign struct {
+	name  string
+	value string
+}
+
+// attrRule is a line of an attributes file: the assignments applied to the files matching the pattern.
+type attrRule struct {
+	re *regexp.Regexp
+	// base rules match the name of the file, others its path relative to the directory of the attributes file
+	base    bool
+	assigns []attrAssign
+}
+
+// attrFile are the rules of an attributes file, for the files of a directory.
+type attrFile struct {
+	dir   string
+	rules []attrRule
+}
+
+// attributes returns the git attributes of the file, by name: from the global attributes file, the .gitattributes
+// files of the working tree from the root to the directory of the file, and the info/attributes file of the
+// repository, the later overriding the former.
+func (r *Repository) attributes(file string) (map[string]string, error) {
+	conf, err := r.config()
+	if err != nil {
+		return nil, err
+	}
+	if r.macros == nil {
+		// the binary macro is built in
+		r.macros = map[string][]attrAssign{
+			"binary": {{name: "diff", value: attrUnset}, {name: "merge", value: attrUnset}, {name: "text", value: attrUnset}},
+		}
+		global := conf["core.attributesfile"]
+		if global != "" {
+			global = expandPath(global, "")
+		} else if dir := xdgConfigHome(); dir != "" {
+			global = filepath.Join(dir, "git", "attributes")
+		}
+		// the macros can only be defined in the top level files, read first
+		r.globalAttrs, err = r.readAttributes(global, "", true)
+		if err != nil {
+			return nil, err
+		}
+		r.infoAttrs, err = r.readAttributes(filepath.Join(r.commonDir, "info", "attributes"), "", true)
+		if err != nil {
+			return nil, err
+		}
+		r.dirAttrs = map[string]attrFile{}
+	}
+
+	files := []attrFile{r.globalAttrs}
+	dir := ""
+	for _, elem := range append([]string{""}, strings.Split(path.Dir(file), "/")...) {
+		if elem == "." {
+			continue
+		}
+		dir = path.Join(dir, elem)
+		f, ok := r.dirAttrs[dir]
+		if !ok {
+			if f, err = r.readAttributes(filepath.Join(r.Dir, filepath.FromSlash(dir), ".gitattributes"), dir, dir == ""); err != nil {
+				return nil, err
+			}
+			r.dirAttrs[dir] = f
+		}
+		files = append(files, f)
+	}
+	files = append(files, r.infoAttrs)
+
+	attrs := map[string]string{}
+	for _, f := range files {
+		rel := file
+		if f.dir != "" {
+			rel = strings.TrimPrefix(file, f.dir+"/")
+		}
+		for _, rule := range f.rules {
+			name := rel
+			if rule.base {
+				name = path.Base(rel)
+			}
+			if !rule.re.MatchString(name) {
+				continue
+			}
+			for _, a := range rule.assigns {
+				r.assign(attrs, a)
+			}
+		}
+	}
+	return attrs, nil
+}
+
+// assign applies the assignment to the attributes, and the ones of the macro when a macro is set.
+func (r *Repository) assign(attrs map[string]string, a attrAssign) {
+	if a.value == "" {
+		delete(attrs, a.name)
+	} else {
+		attrs[a.name] = a.value
+	}
+	if a.value == attrSet {
+		for _, m := range r.macros[a.name] {
+			r.assign(attrs, m)
+		}
+	}
+}
+
+// readAttributes reads the rules of an attributes file, if it exists. The macros are read if allowed.
+func (r *Repository) readAttributes(file, dir string, macros bool) (attrFile, error) {
+	attrs := attrFile{dir: dir}
+	if file == "" {
+		return attrs, nil
+	}
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return attrs, nil
+	}
+	if err != nil {
+		return attrs, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		var assigns []attrAssign
+		for _, field := range fields[1:] {
+			switch {
+			case strings.HasPrefix(field, "-"):
+				assigns = append(assigns, attrAssign{name: field[1:], value: attrUnset})
+			case strings.HasPrefix(field, "!"):
+				assigns = append(assigns, attrAssign{name: field[1:]})
+			default:
+				name, value, ok := strings.Cut(field, "=")
+				if !ok {
+					value = attrSet
+				}
+				assigns = append(assigns, attrAssign{name: name, value: value})
+			}
+		}
+
+		pattern := fields[0]
+		if strings.HasPrefix(pattern, "[attr]") {
+			if macros {
+				r.macros[strings.TrimPrefix(pattern, "[attr]")] = assigns
+			}
+			continue
+		}
+		// negative patterns are forbidden, and patterns of directories don't match their files
+		if strings.HasPrefix(pattern, "!") || strings.HasSuffix(pattern, "/") {
+			continue
+		}
+		base := !strings.Contains(pattern, "/")
+		re, err := globRegexp(strings.TrimPrefix(pattern, "/"), false)
+		if err != nil {
+			continue
+		}
+		attrs.rules = append(attrs.rules, attrRule{re: re, base: base, assigns: assigns})
+	}
+	return attrs, scanner.Err()
+}
@@ -0,0 +1,337 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// maxIncludeDepth limits the nested includes of the configuration files, like git.
+const maxIncludeDepth = 10
+
+// gitConfig is the git configuration, by key. The section and the name of the keys are lowercase, like core.autocrlf,
+// the subsections keep their case, like filter.lfs.clean.
+type gitConfig map[string]string
+
+// bool returns the boolean value of the key, false if not set.
+func (c gitConfig) bool(key string) bool {
+	switch strings.ToLower(c[key]) {
+	case "true", "yes", "on", "1":
+		return true
+	}
+	return false
+}
+
+// config reads the system, global and repository configurations, with their included files, then the configuration of
+// the environment. Later values override earlier ones, like with git.
+func (r *Repository) config() (gitConfig, error) {
+	if r.conf != nil {
+		return r.conf, nil
+	}
+	conf := gitConfig{}
+	for _, f := range configFiles(r.commonDir) {
+		if err := r.readConfig(conf, f, 0); err != nil {
+			return nil, err
+		}
+	}
+	// git -c and GIT_CONFIG_KEY_n=GIT_CONFIG_VALUE_n
+	count, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	for i := 0; i < count; i++ {
+		if key := os.Getenv(fmt.Sprintf("GIT_CONFIG_KEY_%d", i)); key != "" {
+			conf[normalizeKey(key)] = os.Getenv(fmt.Sprintf("GIT_CONFIG_VALUE_%d", i))
+		}
+	}
+	r.conf = conf
+	return conf, nil
+}
+
+// configFiles returns the system, global and repository configuration files, following the git environment variables.
+func configFiles(commonDir string) []string {
+	var files []string
+	if nosystem := strings.ToLower(os.Getenv("GIT_CONFIG_NOSYSTEM")); nosystem == "" || nosystem == "0" || nosystem == "false" {
+		switch {
+		case os.Getenv("GIT_CONFIG_SYSTEM") != "":
+			files = append(files, os.Getenv("GIT_CONFIG_SYSTEM"))
+		case runtime.GOOS == "windows":
+			files = append(files,
+				filepath.Join(os.Getenv("ProgramData"), "Git", "config"),
+				filepath.Join(os.Getenv("ProgramFiles"), "Git", "etc", "gitconfig"))
+		default:
+			files = append(files, "/etc/gitconfig")
+		}
+	}
+	if global := os.Getenv("GIT_CONFIG_GLOBAL"); global != "" {
+		files = append(files, global)
+	} else {
+		if dir := xdgConfigHome(); dir != "" {
+			files = append(files, filepath.Join(dir, "git", "config"))
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			files = append(files, filepath.Join(home, ".gitconfig"))
+		}
+	}
+	return append(files, filepath.Join(commonDir, "config"))
+}
+
+// xdgConfigHome returns the XDG configuration directory used by git, even on macOS and Windows.
+func xdgConfigHome() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config")
+	}
+	return ""
+}
+
+// readConfig reads a configuration file, if it exists, into conf. The include.path and includeIf.<condition>.path
+// files are read at their position, the gitdir and onbranch conditions are supported.
+func (r *Repository) readConfig(conf gitConfig, file string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("exceeded maximum include depth reading %s", file)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		// like git, missing or unreadable files are ignored
+		return nil
+	}
+	defer f.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// a value can continue on the next line
+		for strings.HasSuffix(line, `\`) && !strings.HasSuffix(line, `\\`) && scanner.Scan() {
+			line = line[:len(line)-1] + scanner.Text()
+		}
+		if strings.HasPrefix(line, "[") {
+			end := strings.LastIndex(line, "]")
+			if end < 0 {
+				return fmt.Errorf("invalid section %q in %s", line, file)
+			}
+			section = parseSection(line[1:end])
+			line = strings.TrimSpace(line[end+1:])
+		}
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if ok {
+			value = parseValue(value)
+		} else {
+			// a key without value is a true boolean
+			value = "true"
+		}
+		key := section + "." + name
+		conf[key] = value
+
+		if include, ok := r.includePath(key, value, file); ok {
+			if err := r.readConfig(conf, include, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// includePath returns the path of the file to include for include.path, or includeIf.<condition>.path if the
+// condition is met.
+func (r *Repository) includePath(key, value, file string) (string, bool) {
+	switch {
+	case key == "include.path":
+	case strings.HasPrefix(key, "includeif.") && strings.HasSuffix(key, ".path"):
+		if !r.includeIf(strings.TrimSuffix(strings.TrimPrefix(key, "includeif."), ".path"), file) {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	return expandPath(value, filepath.Dir(file)), true
+}
+
+// includeIf evaluates the condition of an includeIf section.
+func (r *Repository) includeIf(condition, file string) bool {
+	kind, pattern, ok := strings.Cut(condition, ":")
+	if !ok {
+		return false
+	}
+	switch kind {
+	case "gitdir", "gitdir/i":
+		if strings.HasPrefix(pattern, "./") {
+			pattern = filepath.ToSlash(filepath.Dir(file)) + pattern[1:]
+		}
+		pattern = filepath.ToSlash(expandPath(pattern, ""))
+		if !strings.HasPrefix(pattern, "/") && !filepath.IsAbs(pattern) {
+			pattern = "**/" + pattern
+		}
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		return matchGlob(pattern, filepath.ToSlash(r.gitDir)+"/", kind == "gitdir/i") ||
+			matchGlob(pattern, filepath.ToSlash(r.gitDir), kind == "gitdir/i")
+	case "onbranch":
+		_, branch, err := r.Head()
+		if err != nil || branch == "" {
+			return false
+		}
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		return matchGlob(pattern, branch, false)
+	}
+	return false
+}
+
+// expandPath expands the ~ of the path, and makes it relative to dir if it's not absolute and dir is set.
+func expandPath(p, dir string) string {
+	if strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			p = filepath.Join(home, p[2:])
+		}
+	}
+	if dir != "" && !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	return p
+}
+
+// parseSection returns the name of the section, like filter.lfs for [filter "lfs"] and [filter.lfs].
+func parseSection(s string) string {
+	name, sub, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		// deprecated [section.subsection] syntax, the subsection is lowercase too
+		return strings.ToLower(name)
+	}
+	sub = strings.TrimSpace(sub)
+	sub = strings.TrimSuffix(strings.TrimPrefix(sub, `"`), `"`)
+	sub = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(sub)
+	return strings.ToLower(name) + "." + sub
+}
+
+// parseValue parses a configuration value: the quotes and escapes are removed, and the comment ignored.
+func parseValue(s string) string {
+	var (
+		value   strings.Builder
+		quoted  bool
+		escaped bool
+		// spaces are only kept between words or quoted
+		spaces string
+	)
+	for _, c := range strings.TrimSpace(s) {
+		switch {
+		case escaped:
+			switch c {
+			case 'n':
+				c = '\n'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			}
+			value.WriteString(spaces)
+			spaces = ""
+			value.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case !quoted && (c == '#' || c == ';'):
+			return value.String()
+		case !quoted && (c == ' ' || c == '\t'):
+			spaces += string(c)
+		default:
+			value.WriteString(spaces)
+			spaces = ""
+			value.WriteRune(c)
+		}
+	}
+	return value.String()
+}
+
+// normalizeKey lowercases the section and name of a key, keeping the case of the subsection.
+func normalizeKey(key string) string {
+	first := strings.Index(key, ".")
+	last := strings.LastIndex(key, ".")
+	if first < 0 {
+		return strings.ToLower(key)
+	}
+	return strings.ToLower(key[:first]) + key[first:last] + strings.ToLower(key[last:])
+}
+
+// matchGlob matches the name with a wildcard pattern of git, where * doesn't match slashes and ** matches any number
+// of directories.
+func matchGlob(pattern, name string, fold bool) bool {
+	re, err := globRegexp(pattern, fold)
+	return err == nil && re.MatchString(name)
+}
+
+// globRegexp converts a wildcard pattern of git to a regular expression.
+func globRegexp(pattern string, fold bool) (*regexp.Regexp, error) {
+	var b strings.Builder
+	if fold {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**") && (i == 0 || pattern[i-1] == '/') {
+				if i+2 == len(pattern) {
+					b.WriteString(".*")
+					i++
+					continue
+				}
+				if pattern[i+2] == '/' {
+					b.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				}
+			}
+			for i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := i + 1
+			if end < len(pattern) && (pattern[end] == '!' || pattern[end] == '^') {
+				end++
+			}
+			if end < len(pattern) && pattern[end] == ']' {
+				end++
+			}
+			for end < len(pattern) && pattern[end] != ']' {
+				end++
+			}
+			if end >= len(pattern) {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i = end
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
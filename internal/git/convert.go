@@ -0,0 +1,132 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+)
+
+// lfsPointer is the content stored by git-lfs in place of the files it tracks.
+const lfsPointer = "version https://git-lfs.github.com/spec/v1\noid sha256:%x\nsize %d\n"
+
+var identRegexp = regexp.MustCompile(`\$Id:[^$\n]*\$`)
+
+// clean converts the content of a file of the working tree to the content stored by git, like git add does: the
+// git-lfs pointer of the files tracked by git-lfs, the line endings normalized following the text and eol attributes
+// and core.autocrlf, and the ident keywords collapsed. Other filters and working tree encodings require the git
+// binary, they are not supported.
+func (r *Repository) clean(e indexEntry, content []byte) ([]byte, error) {
+	conf, err := r.config()
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := r.attributes(e.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter, ok := attrs["filter"]; ok && filter != attrSet && filter != attrUnset {
+		driver := "filter." + filter
+		configured := conf[driver+".clean"] != "" || conf[driver+".process"] != ""
+		switch {
+		case configured && filter == "lfs":
+			content = []byte(fmt.Sprintf(lfsPointer, sha256.Sum256(content), len(content)))
+		case configured || conf.bool(driver+".required"):
+			return nil, fmt.Errorf("could not check %s: the %s filter is not supported", e.path, filter)
+		}
+	}
+	if encoding, ok := attrs["working-tree-encoding"]; ok && encoding != attrUnset {
+		return nil, fmt.Errorf("could not check %s: working-tree-encoding is not supported", e.path)
+	}
+
+	if r.crlfToLF(e, attrs, conf, content) {
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	}
+	if attrs["ident"] == attrSet {
+		content = identRegexp.ReplaceAll(content, []byte("$$Id$$"))
+	}
+	return content, nil
+}
+
+// crlfToLF reports whether the line endings of the content are converted to LF, like git does.
+func (r *Repository) crlfToLF(e indexEntry, attrs map[string]string, conf gitConfig, content []byte) bool {
+	text, ok := attrs["text"]
+	if !ok {
+		// the crlf attribute is the deprecated text attribute
+		text, ok = attrs["crlf"]
+		if text == "input" {
+			text = attrSet
+		}
+	}
+	if !ok {
+		if eol := attrs["eol"]; eol == "lf" || eol == "crlf" {
+			// eol sets text
+			text, ok = attrSet, true
+		}
+	}
+	auto := false
+	switch {
+	case !ok:
+		autocrlf := conf["core.autocrlf"]
+		if autocrlf != "input" && !conf.bool("core.autocrlf") {
+			return false
+		}
+		auto = true
+	case text == attrUnset:
+		return false
+	case text == "auto":
+		auto = true
+	case text != attrSet:
+		return false
+	}
+
+	if !bytes.Contains(content, []byte("\r\n")) {
+		return false
+	}
+	if auto {
+		if isBinary(content) {
+			return false
+		}
+		// like git, a file stored with carriage returns keeps them
+		if _, stored, err := r.objects.read(e.hash); err != nil || bytes.IndexByte(stored, '\r') >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isBinary guesses if the content is binary, like git: with a nul byte, a carriage return not followed by a line
+// feed or too many non printable characters.
+func isBinary(content []byte) bool {
+	var printable, nonPrintable int
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '\r':
+			if i+1 >= len(content) || content[i+1] != '\n' {
+				return true
+			}
+			i++
+		case c == '\n':
+		case c == 0:
+			return true
+		case c == 127:
+			nonPrintable++
+		case c < 32:
+			switch c {
+			case '\b', '\t', '\033', '\014':
+				printable++
+			default:
+				nonPrintable++
+			}
+		default:
+			printable++
+		}
+	}
+	// a final end of file character is ignored
+	if len(content) > 0 && content[len(content)-1] == '\032' {
+		nonPrintable--
+	}
+	return printable>>7 < nonPrintable
+}
@@ -0,0 +1,62 @@
+package git
+
+import (
+	"sort"
+	"strings"
+)
+
+// Commit is a commit of the history.
+type Commit struct {
+	Hash    Hash
+	Message string
+	time    int64
+}
+
+// Subject returns the first line of the message.
+func (c Commit) Subject() string {
+	subject, _, _ := strings.Cut(c.Message, "\n")
+	return subject
+}
+
+// Body returns the message without its subject.
+func (c Commit) Body() string {
+	_, body, _ := strings.Cut(c.Message, "\n")
+	return strings.TrimSpace(body)
+}
+
+// CommitsSince returns the commits reachable from HEAD but not from the since commit, most recent first.
+// If since is nil, the whole history is returned.
+func (r *Repository) CommitsSince(since *Hash) ([]Commit, error) {
+	head, _, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+	history, err := r.reachable(head, since)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []Commit
+	for h := range history {
+		_, data, err := r.objects.read(h)
+		if err != nil {
+			return nil, err
+		}
+		t, err := r.commitTime(h)
+		if err != nil {
+			return nil, err
+		}
+		message := ""
+		if _, m, ok := strings.Cut(string(data), "\n\n"); ok {
+			message = strings.TrimSpace(m)
+		}
+		commits = append(commits, Commit{Hash: h, Message: message, time: t})
+	}
+	sort.SliceStable(commits, func(i, j int) bool {
+		if commits[i].time == commits[j].time {
+			return commits[i].Hash.String() < commits[j].Hash.String()
+		}
+		return commits[i].time > commits[j].time
+	})
+	return commits, nil
+}
@@ -0,0 +1,472 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"container/list"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Hash is the SHA-1 identifier of a git object.
+type Hash [20]byte
+
+// ParseHash parses the hexadecimal representation of a hash.
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(h) {
+		return h, fmt.Errorf("invalid object name %q", s)
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+type objectType int
+
+const (
+	objCommit   objectType = 1
+	objTree     objectType = 2
+	objBlob     objectType = 3
+	objTag      objectType = 4
+	objOfsDelta objectType = 6
+	objRefDelta objectType = 7
+)
+
+var objectTypes = map[string]objectType{
+	"commit": objCommit,
+	"tree":   objTree,
+	"blob":   objBlob,
+	"tag":    objTag,
+}
+
+// errClosed is returned when reading a packed object after closing the repository.
+var errClosed = errors.New("the repository is closed")
+
+// objectStore reads loose and packed objects.
+type objectStore struct {
+	dir string
+
+	once     sync.Once
+	packs    []*pack
+	packsErr error
+	cache    objectCache
+}
+
+func newObjectStore(dir string) *objectStore {
+	return &objectStore{dir: dir}
+}
+
+// close closes the pack files, packed objects can't be read anymore.
+func (s *objectStore) close() error {
+	// the packs are not opened after close
+	s.once.Do(func() {})
+	var err error
+	for _, p := range s.packs {
+		if cerr := p.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	s.packs, s.packsErr = nil, errClosed
+	s.cache = objectCache{}
+	return err
+}
+
+func (s *objectStore) read(h Hash) (objectType, []byte, error) {
+	typ, data, err := s.readLoose(h)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return typ, data, err
+	}
+
+	s.once.Do(func() {
+		s.packs, s.packsErr = openPacks(filepath.Join(s.dir, "pack"))
+	})
+	if s.packsErr != nil {
+		return 0, nil, s.packsErr
+	}
+	for _, p := range s.packs {
+		if offset, ok := p.find(h); ok {
+			return p.read(s, offset)
+		}
+	}
+	return 0, nil, fmt.Errorf("object %s not found", h)
+}
+
+func (s *objectStore) readLoose(h Hash) (objectType, []byte, error) {
+	name := h.String()
+	f, err := os.Open(filepath.Join(s.dir, name[:2], name[2:]))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	z, err := zlib.NewReader(f)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer z.Close()
+	content, err := io.ReadAll(z)
+	if err != nil {
+		return 0, nil, err
+	}
+	i := bytes.IndexByte(content, 0)
+	if i < 0 {
+		return 0, nil, fmt.Errorf("invalid object %s", h)
+	}
+	typeName, _, _ := strings.Cut(string(content[:i]), " ")
+	typ, ok := objectTypes[typeName]
+	if !ok {
+		return 0, nil, fmt.Errorf("invalid object type %q for %s", typeName, h)
+	}
+	return typ, content[i+1:], nil
+}
+
+// pack is a pack file with its version 2 index.
+type pack struct {
+	file    *os.File
+	names   []Hash
+	offsets []int64
+}
+
+type packedObject struct {
+	typ  objectType
+	data []byte
+}
+
+// maxCacheSize is the maximum size of the packed objects kept in memory.
+const maxCacheSize = 16 << 20
+
+// objectCache keeps the packed objects most recently read, up to maxCacheSize bytes. They are mostly the bases of the
+// deltas, read again for each object stored as a delta of them.
+type objectCache struct {
+	mu      sync.Mutex
+	size    int
+	lru     *list.List // of *cacheEntry, the most recently used first
+	entries map[cacheKey]*list.Element
+}
+
+type cacheKey struct {
+	pack   *pack
+	offset int64
+}
+
+type cacheEntry struct {
+	key cacheKey
+	obj packedObject
+}
+
+func (c *objectCache) get(key cacheKey) (packedObject, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return packedObject{}, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).obj, true
+}
+
+func (c *objectCache) add(key cacheKey, obj packedObject) {
+	if len(obj.data) > maxCacheSize {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[cacheKey]*list.Element{}
+		c.lru = list.New()
+	}
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, obj: obj})
+	c.size += len(obj.data)
+	for c.size > maxCacheSize {
+		oldest := c.lru.Remove(c.lru.Back()).(*cacheEntry)
+		delete(c.entries, oldest.key)
+		c.size -= len(oldest.obj.data)
+	}
+}
+
+func openPacks(dir string) ([]*pack, error) {
+	indexes, err := filepath.Glob(filepath.Join(dir, "*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	var packs []*pack
+	for _, idx := range indexes {
+		p, err := openPack(idx)
+		if err != nil {
+			for _, opened := range packs {
+				_ = opened.file.Close()
+			}
+			return nil, err
+		}
+		packs = append(packs, p)
+	}
+	return packs, nil
+}
+
+func openPack(idx string) (*pack, error) {
+	data, err := os.ReadFile(idx)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(data[4:8]) != 2 {
+		return nil, fmt.Errorf("unsupported pack index %s", idx)
+	}
+	count := int(binary.BigEndian.Uint32(data[8+255*4:]))
+	namesStart := 8 + 256*4
+	offsetsStart := namesStart + count*20 + count*4
+	largeStart := offsetsStart + count*4
+	if len(data) < largeStart {
+		return nil, fmt.Errorf("truncated pack index %s", idx)
+	}
+
+	p := &pack{
+		names:   make([]Hash, count),
+		offsets: make([]int64, count),
+	}
+	for i := 0; i < count; i++ {
+		copy(p.names[i][:], data[namesStart+i*20:])
+		offset := binary.BigEndian.Uint32(data[offsetsStart+i*4:])
+		if offset&0x80000000 != 0 {
+			large := largeStart + int(offset&0x7fffffff)*8
+			if len(data) < large+8 {
+				return nil, fmt.Errorf("truncated pack index %s", idx)
+			}
+			p.offsets[i] = int64(binary.BigEndian.Uint64(data[large:]))
+		} else {
+			p.offsets[i] = int64(offset)
+		}
+	}
+
+	p.file, err = os.Open(strings.TrimSuffix(idx, ".idx") + ".pack")
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *pack) find(h Hash) (int64, bool) {
+	i := sort.Search(len(p.names), func(i int) bool {
+		return bytes.Compare(p.names[i][:], h[:]) >= 0
+	})
+	if i < len(p.names) && p.names[i] == h {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+func (p *pack) read(s *objectStore, offset int64) (objectType, []byte, error) {
+	key := cacheKey{pack: p, offset: offset}
+	if cached, ok := s.cache.get(key); ok {
+		return cached.typ, cached.data, nil
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(p.file, offset, 1<<62))
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	typ := objectType((b >> 4) & 7)
+	for b&0x80 != 0 {
+		// the size is not needed, the data is read up to the end of the zlib stream
+		if b, err = r.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	var base func() (objectType, []byte, error)
+	switch typ {
+	case objOfsDelta:
+		b, err = r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		distance := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = r.ReadByte(); err != nil {
+				return 0, nil, err
+			}
+			distance = ((distance + 1) << 7) | int64(b&0x7f)
+		}
+		base = func() (objectType, []byte, error) { return p.read(s, offset-distance) }
+	case objRefDelta:
+		var h Hash
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			return 0, nil, err
+		}
+		base = func() (objectType, []byte, error) { return s.read(h) }
+	}
+
+	z, err := zlib.NewReader(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := io.ReadAll(z)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if base != nil {
+		var baseData []byte
+		typ, baseData, err = base()
+		if err != nil {
+			return 0, nil, err
+		}
+		if data, err = applyDelta(baseData, data); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	s.cache.add(key, packedObject{typ: typ, data: data})
+	return typ, data, nil
+}
+
+func applyDelta(base, delta []byte) ([]byte, error) {
+	errInvalid := errors.New("invalid delta")
+	readSize := func() (int, bool) {
+		size, shift := 0, 0
+		for {
+			if len(delta) == 0 {
+				return 0, false
+			}
+			b := delta[0]
+			delta = delta[1:]
+			size |= int(b&0x7f) << shift
+			shift += 7
+			if b&0x80 == 0 {
+				return size, true
+			}
+		}
+	}
+	baseSize, ok := readSize()
+	if !ok || baseSize != len(base) {
+		return nil, errInvalid
+	}
+	size, ok := readSize()
+	if !ok {
+		return nil, errInvalid
+	}
+
+	out := make([]byte, 0, size)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		if op&0x80 == 0 {
+			// insert the next op bytes
+			n := int(op)
+			if n == 0 || len(delta) < n {
+				return nil, errInvalid
+			}
+			out = append(out, delta[:n]...)
+			delta = delta[n:]
+			continue
+		}
+		// copy from the base, offset and size are encoded on the bytes flagged in op
+		var offset, n int
+		for i := 0; i < 4; i++ {
+			if op&(1<<i) != 0 {
+				if len(delta) == 0 {
+					return nil, errInvalid
+				}
+				offset |= int(delta[0]) << (8 * i)
+				delta = delta[1:]
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if op&(0x10<<i) != 0 {
+				if len(delta) == 0 {
+					return nil, errInvalid
+				}
+				n |= int(delta[0]) << (8 * i)
+				delta = delta[1:]
+			}
+		}
+		if n == 0 {
+			n = 0x10000
+		}
+		if offset+n > len(base) {
+			return nil, errInvalid
+		}
+		out = append(out, base[offset:offset+n]...)
+	}
+	if len(out) != size {
+		return nil, errInvalid
+	}
+	return out, nil
+}
+
+// header returns the value of the first header with the given key, in commit and tag objects.
+func header(data []byte, key string) (string, bool) {
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			// end of headers
+			break
+		}
+		if k, v, ok := strings.Cut(line, " "); ok && k == key {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// parents returns the parents of a commit.
+func (r *Repository) parents(h Hash) ([]Hash, error) {
+	if r.shallow[h] {
+		return nil, nil
+	}
+	typ, data, err := r.objects.read(h)
+	if err != nil {
+		return nil, err
+	}
+	if typ != objCommit {
+		return nil, fmt.Errorf("object %s is not a commit", h)
+	}
+	var parents []Hash
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "parent ") {
+			p, err := ParseHash(strings.TrimPrefix(line, "parent "))
+			if err != nil {
+				return nil, err
+			}
+			parents = append(parents, p)
+		}
+	}
+	return parents, nil
+}
+
+// commitTime returns the committer time of a commit, as a unix timestamp.
+func (r *Repository) commitTime(h Hash) (int64, error) {
+	_, data, err := r.objects.read(h)
+	if err != nil {
+		return 0, err
+	}
+	committer, ok := header(data, "committer")
+	if !ok {
+		return 0, fmt.Errorf("invalid commit %s", h)
+	}
+	fields := strings.Fields(committer)
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("invalid commit %s", h)
+	}
+	return strconv.ParseInt(fields[len(fields)-2], 10, 64)
+}
@@ -0,0 +1,252 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when no git repository can be found.
+	ErrNotFound = errors.New("not a git repository")
+	// ErrNoCommit is returned when HEAD points to a branch without commit, in a new repository.
+	ErrNoCommit = errors.New("the current branch has no commit")
+
+	errRefNotFound = errors.New("could not resolve reference")
+)
+
+// Repository reads a git repository, without relying on a git binary. Nothing is written, the release commits and tags
+// are created with the git binary, see the release package.
+type Repository struct {
+	// Dir is the root of the working tree.
+	Dir string
+	// gitDir contains HEAD and the index, commonDir the refs and objects. They are different for worktrees.
+	gitDir    string
+	commonDir string
+	objects   *objectStore
+	// shallow commits of shallow clones, their parents are not available
+	shallow map[Hash]bool
+	// conf is the git configuration, once read
+	conf gitConfig
+	// macros, globalAttrs, infoAttrs and dirAttrs are the attributes files, once read, see attributes
+	macros      map[string][]attrAssign
+	globalAttrs attrFile
+	infoAttrs   attrFile
+	dirAttrs    map[string]attrFile
+}
+
+// Open looks for a git repository in dir or one of its parents.
+func Open(dir string) (*Repository, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if stat, err := os.Stat(dotGit); err == nil {
+			gitDir := dotGit
+			if !stat.IsDir() {
+				// worktrees and submodules use a file pointing to the real git directory
+				gitDir, err = readGitFile(dotGit)
+				if err != nil {
+					return nil, err
+				}
+			}
+			commonDir := gitDir
+			if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+				commonDir = strings.TrimSpace(string(data))
+				if !filepath.IsAbs(commonDir) {
+					commonDir = filepath.Join(gitDir, commonDir)
+				}
+			}
+			shallow := map[Hash]bool{}
+			if data, err := os.ReadFile(filepath.Join(commonDir, "shallow")); err == nil {
+				for _, line := range strings.Fields(string(data)) {
+					if h, err := ParseHash(line); err == nil {
+						shallow[h] = true
+					}
+				}
+			}
+			return &Repository{
+				Dir:       dir,
+				gitDir:    gitDir,
+				commonDir: commonDir,
+				objects:   newObjectStore(filepath.Join(commonDir, "objects")),
+				shallow:   shallow,
+			}, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotFound
+		}
+		dir = parent
+	}
+}
+
+// Close closes the pack files kept open to read the objects. The repository can't be used after.
+func (r *Repository) Close() error {
+	return r.objects.close()
+}
+
+func readGitFile(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	content := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(content, "gitdir: ") {
+		return "", fmt.Errorf("invalid git file %s", file)
+	}
+	gitDir := strings.TrimPrefix(content, "gitdir: ")
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(file), gitDir)
+	}
+	return gitDir, nil
+}
+
+// Head returns the commit of HEAD and the current branch, empty if HEAD is detached.
+func (r *Repository) Head() (Hash, string, error) {
+	data, err := os.ReadFile(filepath.Join(r.gitDir, "HEAD"))
+	if err != nil {
+		return Hash{}, "", err
+	}
+	head := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(head, "ref: ") {
+		h, err := ParseHash(head)
+		return h, "", err
+	}
+	ref := strings.TrimPrefix(head, "ref: ")
+	h, err := r.resolveRef(ref)
+	if errors.Is(err, errRefNotFound) {
+		return Hash{}, "", fmt.Errorf("%w: %s", ErrNoCommit, ref)
+	}
+	if err != nil {
+		return Hash{}, "", err
+	}
+	return h, strings.TrimPrefix(ref, "refs/heads/"), nil
+}
+
+func (r *Repository) resolveRef(ref string) (Hash, error) {
+	for _, dir := range []string{r.gitDir, r.commonDir} {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(ref)))
+		if err != nil {
+			continue
+		}
+		content := strings.TrimSpace(string(data))
+		if strings.HasPrefix(content, "ref: ") {
+			return r.resolveRef(strings.TrimPrefix(content, "ref: "))
+		}
+		return ParseHash(content)
+	}
+	refs, err := r.packedRefs()
+	if err != nil {
+		return Hash{}, err
+	}
+	if h, ok := refs[ref]; ok {
+		return h, nil
+	}
+	return Hash{}, fmt.Errorf("%w %s", errRefNotFound, ref)
+}
+
+// packedRefs reads the references stored in the packed-refs file.
+func (r *Repository) packedRefs() (map[string]Hash, error) {
+	refs := map[string]Hash{}
+	f, err := os.Open(filepath.Join(r.commonDir, "packed-refs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return refs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		h, err := ParseHash(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		refs[fields[1]] = h
+	}
+	return refs, scanner.Err()
+}
+
+// Tags returns all the tags of the repository, by name, peeled to the commit they point to.
+func (r *Repository) Tags() (map[string]Hash, error) {
+	refs, err := r.packedRefs()
+	if err != nil {
+		return nil, err
+	}
+	tags := map[string]Hash{}
+	for ref, h := range refs {
+		if strings.HasPrefix(ref, "refs/tags/") {
+			tags[strings.TrimPrefix(ref, "refs/tags/")] = h
+		}
+	}
+
+	tagsDir := filepath.Join(r.commonDir, "refs", "tags")
+	err = filepath.Walk(tagsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(tagsDir, path)
+		if err != nil {
+			return err
+		}
+		h, err := r.resolveRef("refs/tags/" + filepath.ToSlash(name))
+		if err != nil {
+			return err
+		}
+		tags[filepath.ToSlash(name)] = h
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name, h := range tags {
+		commit, err := r.peel(h)
+		if err != nil {
+			return nil, err
+		}
+		tags[name] = commit
+	}
+	return tags, nil
+}
+
+// peel follows annotated tags up to the object they point to.
+func (r *Repository) peel(h Hash) (Hash, error) {
+	for {
+		typ, data, err := r.objects.read(h)
+		if err != nil {
+			return Hash{}, err
+		}
+		if typ != objTag {
+			return h, nil
+		}
+		target, ok := header(data, "object")
+		if !ok {
+			return Hash{}, fmt.Errorf("invalid tag object %s", h)
+		}
+		if h, err = ParseHash(target); err != nil {
+			return Hash{}, err
+		}
+	}
+}
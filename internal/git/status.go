@@ -0,0 +1,298 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // git object names are SHA-1
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	modeTree    = 0o40000
+	modeSymlink = 0o120000
+	modeGitlink = 0o160000
+)
+
+type indexEntry struct {
+	path    string
+	hash    Hash
+	mode    uint32
+	size    uint32
+	mtime   uint32
+	mtimeNs uint32
+	// skip is set for entries that are not expected in the working tree: skip-worktree, intent-to-add and conflicts
+	skip bool
+}
+
+// Dirty reports whether the working tree or the index have changes compared to HEAD. Like git describe --dirty,
+// untracked files are ignored. The files are compared as git would store them, with their line endings normalized,
+// see clean.
+func (r *Repository) Dirty() (bool, error) {
+	entries, indexTime, err := r.index()
+	if err != nil {
+		return false, err
+	}
+
+	head, _, err := r.Head()
+	if err != nil {
+		return false, err
+	}
+	tree, err := r.commitTree(head)
+	if err != nil {
+		return false, err
+	}
+	files := map[string]Hash{}
+	if err := r.flattenTree(tree, "", files); err != nil {
+		return false, err
+	}
+
+	if len(files) != len(entries) {
+		return true, nil
+	}
+	for _, e := range entries {
+		if h, ok := files[e.path]; !ok || h != e.hash {
+			// staged changes
+			return true, nil
+		}
+		if e.skip || e.mode == modeGitlink {
+			continue
+		}
+		modified, err := r.modified(e, indexTime)
+		if err != nil {
+			return false, err
+		}
+		if modified {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// modified compares a file of the working tree with its index entry. Like git, the content is only compared if the
+// size and modification time recorded in the index don't match the file, or if the file was modified when the index
+// was written.
+func (r *Repository) modified(e indexEntry, indexTime time.Time) (bool, error) {
+	file := filepath.Join(r.Dir, filepath.FromSlash(e.path))
+	stat, err := os.Lstat(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// git sets the size of the racily clean entries to 0, to always compare their content
+	if e.size != 0 {
+		if uint32(stat.Size()) != e.size {
+			return true, nil
+		}
+		mtime := stat.ModTime()
+		racy := int64(e.mtime) > indexTime.Unix() ||
+			int64(e.mtime) == indexTime.Unix() && int(e.mtimeNs) >= indexTime.Nanosecond()
+		if uint32(mtime.Unix()) == e.mtime && uint32(mtime.Nanosecond()) == e.mtimeNs && !racy {
+			return false, nil
+		}
+	}
+
+	if e.mode == modeSymlink {
+		target, err := os.Readlink(file)
+		if err != nil {
+			return false, err
+		}
+		return blobHash([]byte(filepath.ToSlash(target))) != e.hash, nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+	if blobHash(content) == e.hash {
+		return false, nil
+	}
+	if content, err = r.clean(e, content); err != nil {
+		return false, err
+	}
+	return blobHash(content) != e.hash, nil
+}
+
+func blobHash(content []byte) Hash {
+	h := sha1.New() //nolint:gosec // git object names are SHA-1
+	_, _ = fmt.Fprintf(h, "blob %d\x00", len(content))
+	_, _ = h.Write(content)
+	var hash Hash
+	copy(hash[:], h.Sum(nil))
+	return hash
+}
+
+func (r *Repository) commitTree(commit Hash) (Hash, error) {
+	_, data, err := r.objects.read(commit)
+	if err != nil {
+		return Hash{}, err
+	}
+	tree, ok := header(data, "tree")
+	if !ok {
+		return Hash{}, fmt.Errorf("invalid commit %s", commit)
+	}
+	return ParseHash(tree)
+}
+
+// flattenTree lists recursively all the files of a tree, with their object names.
+func (r *Repository) flattenTree(tree Hash, prefix string, files map[string]Hash) error {
+	entries, err := r.readTree(tree)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := path.Join(prefix, e.name)
+		if e.mode == modeTree {
+			if err := r.flattenTree(e.hash, name, files); err != nil {
+				return err
+			}
+			continue
+		}
+		files[name] = e.hash
+	}
+	return nil
+}
+
+type treeEntry struct {
+	mode uint32
+	name string
+	hash Hash
+}
+
+// readTree returns the entries of a tree.
+func (r *Repository) readTree(tree Hash) ([]treeEntry, error) {
+	typ, data, err := r.objects.read(tree)
+	if err != nil {
+		return nil, err
+	}
+	if typ != objTree {
+		return nil, fmt.Errorf("object %s is not a tree", tree)
+	}
+	var entries []treeEntry
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if sp < 0 || nul < sp || len(data) < nul+21 {
+			return nil, fmt.Errorf("invalid tree %s", tree)
+		}
+		mode, err := strconv.ParseUint(string(data[:sp]), 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tree %s", tree)
+		}
+		e := treeEntry{mode: uint32(mode), name: string(data[sp+1 : nul])}
+		copy(e.hash[:], data[nul+1:nul+21])
+		data = data[nul+21:]
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// index reads the entries of the index, in version 2, 3 or 4, and its modification time. It returns no entries if the
+// index doesn't exist.
+func (r *Repository) index() ([]indexEntry, time.Time, error) {
+	file := filepath.Join(r.gitDir, "index")
+	stat, err := os.Stat(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	errInvalid := errors.New("invalid git index")
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return nil, time.Time{}, errInvalid
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, time.Time{}, fmt.Errorf("unsupported git index version %d", version)
+	}
+	count := int(binary.BigEndian.Uint32(data[8:12]))
+
+	var (
+		entries  []indexEntry
+		previous string
+		pos      = 12
+	)
+	for i := 0; i < count; i++ {
+		const fixed = 62
+		if len(data) < pos+fixed {
+			return nil, time.Time{}, errInvalid
+		}
+		e := data[pos:]
+		entry := indexEntry{
+			mtime:   binary.BigEndian.Uint32(e[8:]),
+			mtimeNs: binary.BigEndian.Uint32(e[12:]),
+			mode:    binary.BigEndian.Uint32(e[24:]),
+			size:    binary.BigEndian.Uint32(e[36:]),
+		}
+		copy(entry.hash[:], e[40:60])
+		flags := binary.BigEndian.Uint16(e[60:])
+		stage := (flags >> 12) & 3
+		next := pos + fixed
+		if flags&0x4000 != 0 {
+			if len(data) < next+2 {
+				return nil, time.Time{}, errInvalid
+			}
+			extended := binary.BigEndian.Uint16(data[next:])
+			// skip-worktree and intent-to-add
+			entry.skip = extended&0x4000 != 0 || extended&0x2000 != 0
+			next += 2
+		}
+		entry.skip = entry.skip || stage != 0
+
+		if version == 4 {
+			// the path is prefix compressed based on the previous entry
+			strip, n := offsetVarint(data[next:])
+			if n == 0 || strip > len(previous) {
+				return nil, time.Time{}, errInvalid
+			}
+			next += n
+			nul := bytes.IndexByte(data[next:], 0)
+			if nul < 0 {
+				return nil, time.Time{}, errInvalid
+			}
+			entry.path = previous[:len(previous)-int(strip)] + string(data[next:next+nul])
+			pos = next + nul + 1
+		} else {
+			nul := bytes.IndexByte(data[next:], 0)
+			if nul < 0 {
+				return nil, time.Time{}, errInvalid
+			}
+			entry.path = string(data[next : next+nul])
+			// entries are padded with 1 to 8 nul bytes
+			length := next + nul - pos
+			pos += (length + 8) &^ 7
+		}
+		previous = entry.path
+		entries = append(entries, entry)
+	}
+	return entries, stat.ModTime(), nil
+}
+
+// offsetVarint decodes the variable length integers used by git in index and pack files.
+func offsetVarint(b []byte) (int, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	c := b[0]
+	v, n := int(c&0x7f), 1
+	for c&0x80 != 0 {
+		if n >= len(b) {
+			return 0, 0
+		}
+		c = b[n]
+		n++
+		v = ((v + 1) << 7) | int(c&0x7f)
+	}
+	return v, n
+}
@@ -0,0 +1,189 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirtyLineEndings(t *testing.T) {
+	// lfsClean is a clean filter writing the git-lfs pointer, without requiring git-lfs
+	const lfsClean = `sh -c 'f=$(mktemp); cat >"$f"; ` +
+		`printf "version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %s\n" ` +
+		`"$(sha256sum <"$f" | cut -d" " -f1)" "$(wc -c <"$f" | tr -d " ")"; rm "$f"'`
+	tests := []struct {
+		name   string
+		config map[string]string
+		// files are added after the attributes, with the configuration set
+		attributes string
+		files      map[string]string
+		// change modifies the working tree after the commit
+		change func(t *testing.T, dir string)
+	}{
+		{
+			name:   "autocrlf checkout",
+			config: map[string]string{"core.autocrlf": "true"},
+			files:  map[string]string{"main.go": "package main\r\n\r\nfunc main() {}\r\n"},
+		},
+		{
+			name:   "autocrlf modified file",
+			config: map[string]string{"core.autocrlf": "true"},
+			files:  map[string]string{"main.go": "package main\r\n\r\nfunc main() {}\r\n"},
+			change: func(t *testing.T, dir string) {
+				writeFile(t, dir, "main.go", "package main\r\n\r\nfunc main() {}\r\n\r\n")
+			},
+		},
+		{
+			name:   "autocrlf input",
+			config: map[string]string{"core.autocrlf": "input"},
+			files:  map[string]string{"main.go": "package main\r\n"},
+		},
+		{
+			name:   "autocrlf binary file",
+			config: map[string]string{"core.autocrlf": "true"},
+			files:  map[string]string{"data.bin": "\x00\x01\r\n\x02"},
+		},
+		{
+			name:  "line endings changed without autocrlf",
+			files: map[string]string{"main.go": "package main\n\nfunc main() {}\n"},
+			change: func(t *testing.T, dir string) {
+				// same size, only the line endings are different
+				writeFile(t, dir, "main.go", "package main\r\nfunc main() {}\r\n")
+			},
+		},
+		{
+			name:       "eol attribute",
+			attributes: "*.txt text eol=crlf\n",
+			files:      map[string]string{"docs/notes.txt": "notes\r\n"},
+		},
+		{
+			name:       "text attribute in a sub directory",
+			attributes: "",
+			files: map[string]string{
+				"docs/.gitattributes": "*.md text\n",
+				"docs/README.md":      "# Docs\r\n",
+			},
+		},
+		{
+			name:       "text unset",
+			config:     map[string]string{"core.autocrlf": "true"},
+			attributes: "*.bat -text\n",
+			files:      map[string]string{"run.bat": "echo\r\n"},
+			change: func(t *testing.T, dir string) {
+				writeFile(t, dir, "run.bat", "echo\n\n")
+			},
+		},
+		{
+			name:       "binary macro",
+			config:     map[string]string{"core.autocrlf": "true"},
+			attributes: "*.dat binary\n",
+			files:      map[string]string{"a.dat": "a\r\nb\r\n"},
+		},
+		{
+			name:       "ident",
+			attributes: "*.go ident\n",
+			files:      map[string]string{"main.go": "package main\n\n// $Id$\n"},
+			change: func(t *testing.T, dir string) {
+				// the checkout expands the keyword
+				if err := os.Remove(filepath.Join(dir, "main.go")); err != nil {
+					t.Fatal(err)
+				}
+				runGit(t, dir, "checkout", "--", "main.go")
+			},
+		},
+		{
+			name:       "git-lfs",
+			config:     map[string]string{"filter.lfs.clean": lfsClean, "filter.lfs.required": "true"},
+			attributes: "*.png filter=lfs diff=lfs merge=lfs -text\n",
+			files:      map[string]string{"logo.png": "\x89PNG\r\n\x1a\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newRepository(t)
+			for k, v := range tt.config {
+				runGit(t, dir, "config", k, v)
+			}
+			writeFile(t, dir, ".gitattributes", tt.attributes)
+			for file, content := range tt.files {
+				writeFile(t, dir, file, content)
+			}
+			runGit(t, dir, "add", "-A")
+			runGit(t, dir, "commit", "-q", "-m", "feat: first")
+			if tt.change != nil {
+				tt.change(t, dir)
+			}
+			// the content is compared as the files are not the ones of the index anymore
+			later := time.Now().Add(time.Hour)
+			for file := range tt.files {
+				if err := os.Chtimes(filepath.Join(dir, filepath.FromSlash(file)), later, later); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			repo, err := Open(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer repo.Close()
+			dirty, err := repo.Dirty()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// git status refreshes the index, it must run after
+			status := runGit(t, dir, "status", "--porcelain", "--untracked-files=no")
+			if want := status != ""; dirty != want {
+				t.Errorf("expected dirty %v like git status %q, got %v", want, status, dirty)
+			}
+		})
+	}
+}
+
+func TestDirtyUnsupportedFilter(t *testing.T) {
+	dir := newRepository(t)
+	runGit(t, dir, "config", "filter.crypt.clean", "cat")
+	runGit(t, dir, "config", "filter.crypt.smudge", "cat")
+	writeFile(t, dir, ".gitattributes", "*.key filter=crypt\n")
+	writeFile(t, dir, "secret.key", "secret\n")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "feat: first")
+	writeFile(t, dir, "secret.key", "SECRET\n")
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	if _, err := repo.Dirty(); err == nil {
+		t.Error("expected an error for a filter requiring git")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	dir := newRepository(t)
+	writeFile(t, dir, "included", "[core]\n\tautocrlf = input ; comment\n")
+	writeFile(t, dir, "conditional", "[filter \"Lfs\"]\n\tclean = \"git-lfs clean -- %f\"\n")
+	runGit(t, dir, "config", "include.path", "../included")
+	runGit(t, dir, "config", "includeIf.gitdir:"+filepath.ToSlash(dir)+"/.git.path", "../conditional")
+	runGit(t, dir, "config", "includeIf.onbranch:other.path", "../included-on-other-branch")
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	conf, err := repo.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"core.autocrlf":    runGit(t, dir, "config", "core.autocrlf"),
+		"filter.Lfs.clean": runGit(t, dir, "config", "filter.Lfs.clean"),
+		"user.name":        runGit(t, dir, "config", "user.name"),
+	} {
+		if conf[key] != want {
+			t.Errorf("expected %s to be %q like git config, got %q", key, want, conf[key])
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package git
+
+import (
+	"container/heap"
+	"fmt"
+	"time"
+
+	"github.com/eunomie/dague/internal/semver"
+)
+
+// Version describes the state of the repository, to version the builds.
+type Version struct {
+	// Semver is the version computed from the nearest semver tag, like git describe --tags --dirty without the v
+	// prefix: 1.2.3 on a tag, 1.2.3-4-gabcdef0 four commits after it. Without any tag it's based on 0.0.0.
+	Semver string
+	// Tag is the nearest semver tag reachable from HEAD, empty if none.
+	Tag         string
+	Commit      string
+	ShortCommit string
+	// Branch is empty if HEAD is detached.
+	Branch     string
+	Dirty      bool
+	CommitDate time.Time
+}
+
+// Version computes the version of HEAD.
+func (r *Repository) Version() (Version, error) {
+	head, branch, err := r.Head()
+	if err != nil {
+		return Version{}, err
+	}
+	dirty, err := r.Dirty()
+	if err != nil {
+		return Version{}, err
+	}
+	commitTime, err := r.commitTime(head)
+	if err != nil {
+		return Version{}, err
+	}
+	tag, tagVersion, distance, err := r.describe(head)
+	if err != nil {
+		return Version{}, err
+	}
+
+	short := head.String()[:7]
+	version := tagVersion.String()
+	if distance > 0 {
+		version = fmt.Sprintf("%s-%d-g%s", version, distance, short)
+	}
+	if dirty {
+		version += "-dirty"
+	}
+
+	return Version{
+		Semver:      version,
+		Tag:         tag,
+		Commit:      head.String(),
+		ShortCommit: short,
+		Branch:      branch,
+		Dirty:       dirty,
+		CommitDate:  time.Unix(commitTime, 0).UTC(),
+	}, nil
+}
+
+// describe finds the nearest semver tag from the commit, and the number of commits since this tag.
+// If there's no tag, the distance is the number of commits of the history.
+func (r *Repository) describe(commit Hash) (string, semver.Version, int, error) {
+	tags, err := r.Tags()
+	if err != nil {
+		return "", semver.Version{}, 0, err
+	}
+	type candidate struct {
+		name    string
+		version semver.Version
+	}
+	byCommit := map[Hash]candidate{}
+	for name, h := range tags {
+		v, err := semver.Parse(name)
+		if err != nil {
+			continue
+		}
+		if c, ok := byCommit[h]; !ok || v.Compare(c.version) > 0 {
+			byCommit[h] = candidate{name: name, version: v}
+		}
+	}
+
+	// breadth first walk of the history, the first tagged commit is the nearest one
+	var (
+		found   *candidate
+		tagged  Hash
+		queue   = []Hash{commit}
+		visited = map[Hash]bool{commit: true}
+	)
+	for len(queue) > 0 && found == nil {
+		h := queue[0]
+		queue = queue[1:]
+		if c, ok := byCommit[h]; ok {
+			found, tagged = &c, h
+			break
+		}
+		parents, err := r.parents(h)
+		if err != nil {
+			return "", semver.Version{}, 0, err
+		}
+		for _, p := range parents {
+			if !visited[p] {
+				visited[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+
+	if found == nil {
+		history, err := r.reachable(commit, nil)
+		return "", semver.Version{}, len(history), err
+	}
+	history, err := r.reachable(commit, &tagged)
+	if err != nil {
+		return "", semver.Version{}, 0, err
+	}
+	return found.name, found.version, len(history), nil
+}
+
+// reachable returns the commits reachable from the commit but not from the excluded one, like git rev-list commit
+// ^excluded. The commits are walked from the most recent, and the walk stops once only excluded commits are left, older
+// than all the others: like git, it relies on the commit dates to not read the history before the excluded commit.
+func (r *Repository) reachable(commit Hash, excluded *Hash) (map[Hash]bool, error) {
+	var (
+		queue         commitQueue
+		queued        = map[Hash]bool{}
+		uninteresting = map[Hash]bool{}
+		// walked are the commits reachable from commit, some may be found later to be reachable from excluded
+		walked = map[Hash]bool{}
+		oldest int64
+	)
+	push := func(h Hash) error {
+		t, err := r.commitTime(h)
+		if err != nil {
+			return err
+		}
+		queued[h] = true
+		heap.Push(&queue, queuedCommit{hash: h, time: t})
+		return nil
+	}
+	if err := push(commit); err != nil {
+		return nil, err
+	}
+	if excluded != nil {
+		uninteresting[*excluded] = true
+		if !queued[*excluded] {
+			if err := push(*excluded); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// interesting reports whether some queued commits are not excluded
+	interesting := func() bool {
+		for _, c := range queue {
+			if !uninteresting[c.hash] {
+				return true
+			}
+		}
+		return false
+	}
+	for queue.Len() > 0 {
+		if !interesting() && (len(walked) == 0 || queue[0].time < oldest) {
+			break
+		}
+		c := heap.Pop(&queue).(queuedCommit)
+		parents, err := r.parents(c.hash)
+		if err != nil {
+			return nil, err
+		}
+		if uninteresting[c.hash] {
+			for _, p := range parents {
+				if uninteresting[p] {
+					continue
+				}
+				uninteresting[p] = true
+				// a parent already walked must be walked again, to exclude its own parents
+				if !queued[p] || walked[p] {
+					delete(walked, p)
+					if err := push(p); err != nil {
+						return nil, err
+					}
+				}
+			}
+			continue
+		}
+		if len(walked) == 0 || c.time < oldest {
+			oldest = c.time
+		}
+		walked[c.hash] = true
+		for _, p := range parents {
+			if !queued[p] {
+				if err := push(p); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for h := range walked {
+		if uninteresting[h] {
+			delete(walked, h)
+		}
+	}
+	return walked, nil
+}
+
+// queuedCommit is a commit to walk, with its commit time.
+type queuedCommit struct {
+	hash Hash
+	time int64
+}
+
+// commitQueue is a priority queue of commits, the most recent first.
+type commitQueue []queuedCommit
+
+func (q commitQueue) Len() int            { return len(q) }
+func (q commitQueue) Less(i, j int) bool  { return q[i].time > q[j].time }
+func (q commitQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x interface{}) { *q = append(*q, x.(queuedCommit)) }
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,264 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	commit := func(t *testing.T, dir, file, message string) {
+		t.Helper()
+		writeFile(t, dir, file, message+"\n")
+		runGit(t, dir, "add", "-A")
+		runGit(t, dir, "commit", "-q", "-m", message)
+	}
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, dir string)
+	}{
+		{
+			name: "on a tag",
+			setup: func(t *testing.T, dir string) {
+				runGit(t, dir, "tag", "v1.0.0")
+			},
+		},
+		{
+			name: "on an annotated tag",
+			setup: func(t *testing.T, dir string) {
+				runGit(t, dir, "tag", "-a", "-m", "v1.0.0", "v1.0.0")
+			},
+		},
+		{
+			name: "after a tag",
+			setup: func(t *testing.T, dir string) {
+				runGit(t, dir, "tag", "v1.0.0")
+				commit(t, dir, "a.go", "feat: a")
+				commit(t, dir, "b.go", "fix: b")
+			},
+		},
+		{
+			name: "nearest tag",
+			setup: func(t *testing.T, dir string) {
+				runGit(t, dir, "tag", "v1.0.0")
+				commit(t, dir, "a.go", "feat: a")
+				runGit(t, dir, "tag", "v1.1.0-rc.1")
+				commit(t, dir, "b.go", "fix: b")
+			},
+		},
+		{
+			name: "merged branch",
+			setup: func(t *testing.T, dir string) {
+				runGit(t, dir, "tag", "v1.0.0")
+				runGit(t, dir, "checkout", "-q", "-b", "feature")
+				commit(t, dir, "a.go", "feat: a")
+				runGit(t, dir, "checkout", "-q", "main")
+				commit(t, dir, "b.go", "fix: b")
+				runGit(t, dir, "merge", "-q", "--no-ff", "-m", "merge feature", "feature")
+			},
+		},
+		{
+			name: "modified file",
+			setup: func(t *testing.T, dir string) {
+				runGit(t, dir, "tag", "v1.0.0")
+				writeFile(t, dir, "main.go", "package main\n\nfunc main() {}\n")
+			},
+		},
+		{
+			name: "staged file",
+			setup: func(t *testing.T, dir string) {
+				runGit(t, dir, "tag", "v1.0.0")
+				writeFile(t, dir, "new.go", "package main\n")
+				runGit(t, dir, "add", "new.go")
+			},
+		},
+		{
+			name: "deleted file",
+			setup: func(t *testing.T, dir string) {
+				runGit(t, dir, "tag", "v1.0.0")
+				runGit(t, dir, "rm", "-q", "--cached", "main.go")
+			},
+		},
+		{
+			name: "untracked file",
+			setup: func(t *testing.T, dir string) {
+				runGit(t, dir, "tag", "v1.0.0")
+				writeFile(t, dir, "untracked.go", "package main\n")
+			},
+		},
+		{
+			name: "packed objects",
+			setup: func(t *testing.T, dir string) {
+				runGit(t, dir, "tag", "-a", "-m", "v1.0.0", "v1.0.0")
+				for i := 1; i <= 20; i++ {
+					// a growing file, stored as deltas
+					writeFile(t, dir, "main.go", "package main\n"+strings.Repeat("// line\n", i))
+					runGit(t, dir, "commit", "-q", "-am", "fix: more lines")
+				}
+				runGit(t, dir, "gc", "-q", "--aggressive")
+				runGit(t, dir, "pack-refs", "--all")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newRepository(t)
+			writeFile(t, dir, "main.go", "package main\n")
+			runGit(t, dir, "add", "-A")
+			runGit(t, dir, "commit", "-q", "-m", "feat: first")
+			tt.setup(t, dir)
+
+			repo, err := Open(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer repo.Close()
+			v, err := repo.Version()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			describe := runGit(t, dir, "describe", "--tags", "--dirty")
+			if want := strings.TrimPrefix(describe, "v"); v.Semver != want {
+				t.Errorf("expected version %q like git describe, got %q", want, v.Semver)
+			}
+			if tag := runGit(t, dir, "describe", "--tags", "--abbrev=0"); v.Tag != tag {
+				t.Errorf("expected tag %q, got %q", tag, v.Tag)
+			}
+			if head := runGit(t, dir, "rev-parse", "HEAD"); v.Commit != head {
+				t.Errorf("expected commit %s, got %s", head, v.Commit)
+			}
+			if branch := runGit(t, dir, "branch", "--show-current"); v.Branch != branch {
+				t.Errorf("expected branch %q, got %q", branch, v.Branch)
+			}
+			// git status lists the untracked files, that don't make the tree dirty
+			status := runGit(t, dir, "status", "--porcelain", "--untracked-files=no")
+			if dirty := status != ""; v.Dirty != dirty {
+				t.Errorf("expected dirty %v with status %q, got %v", dirty, status, v.Dirty)
+			}
+		})
+	}
+}
+
+func TestVersionWithoutTag(t *testing.T) {
+	dir := newRepository(t)
+	for _, file := range []string{"a.go", "b.go", "c.go"} {
+		writeFile(t, dir, file, "package main\n")
+		runGit(t, dir, "add", "-A")
+		runGit(t, dir, "commit", "-q", "-m", "feat: "+file)
+	}
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	v, err := repo.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	short := runGit(t, dir, "rev-parse", "--short=7", "HEAD")
+	if want := "0.0.0-3-g" + short; v.Semver != want {
+		t.Errorf("expected version %q, got %q", want, v.Semver)
+	}
+	if v.Tag != "" {
+		t.Errorf("expected no tag, got %q", v.Tag)
+	}
+}
+
+func TestObjectCache(t *testing.T) {
+	var c objectCache
+	p := &pack{}
+	for offset := int64(0); offset < 3; offset++ {
+		c.add(cacheKey{pack: p, offset: offset}, packedObject{typ: objBlob, data: make([]byte, maxCacheSize/2)})
+	}
+	if c.size > maxCacheSize {
+		t.Errorf("expected the cache to be bounded to %d bytes, got %d", maxCacheSize, c.size)
+	}
+	if _, ok := c.get(cacheKey{pack: p, offset: 0}); ok {
+		t.Error("expected the oldest object to be evicted")
+	}
+	if _, ok := c.get(cacheKey{pack: p, offset: 2}); !ok {
+		t.Error("expected the most recent object to be cached")
+	}
+	c.add(cacheKey{pack: p, offset: 3}, packedObject{typ: objBlob, data: make([]byte, maxCacheSize+1)})
+	if _, ok := c.get(cacheKey{pack: p, offset: 3}); ok {
+		t.Error("expected an object larger than the cache not to be cached")
+	}
+}
+
+func TestClose(t *testing.T) {
+	dir := newRepository(t)
+	writeFile(t, dir, "main.go", "package main\n")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "feat: first")
+	runGit(t, dir, "gc", "-q")
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Version(); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Version(); err == nil {
+		t.Error("expected an error reading the packed objects after Close")
+	}
+}
+
+func TestVersionStopsAtTag(t *testing.T) {
+	dir := newRepository(t)
+	var first string
+	for day, file := range []string{"a.go", "b.go", "c.go", "d.go", "e.go"} {
+		writeFile(t, dir, file, "package main\n")
+		runGit(t, dir, "add", "-A")
+		// distinct dates, the history is walked by date
+		cmd := exec.Command("git", "commit", "-q", "-m", "feat: "+file)
+		cmd.Dir = dir
+		date := fmt.Sprintf("2023-01-%02dT10:00:00Z", day+1)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git commit: %v\n%s", err, out)
+		}
+		if day == 0 {
+			first = runGit(t, dir, "rev-parse", "HEAD")
+		}
+		if file == "c.go" {
+			runGit(t, dir, "tag", "v1.0.0")
+		}
+	}
+	// the history before the tag is not needed
+	if err := os.Remove(filepath.Join(dir, ".git", "objects", first[:2], first[2:])); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	v, err := repo.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1.0.0-2-g" + runGit(t, dir, "rev-parse", "--short=7", "HEAD"); v.Semver != want {
+		t.Errorf("expected version %q, got %q", want, v.Semver)
+	}
+	tags, err := repo.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagged := tags["v1.0.0"]
+	commits, err := repo.CommitsSince(&tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || commits[0].Subject() != "feat: e.go" || commits[1].Subject() != "feat: d.go" {
+		t.Errorf("expected the 2 commits since the tag, got %v", commits)
+	}
+}
@@ -0,0 +1,46 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/eunomie/dague/internal/ui"
+)
+
+// CheckGit checks the git binary is available, before changing the working tree of the release.
+func CheckGit() error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return errors.New("git is required to commit the changelog and create the tag")
+	}
+	return nil
+}
+
+// CommitChangelog commits the changelog, and only it, with the git binary. The hooks, the attributes and the signing
+// configuration of the repository apply.
+func CommitChangelog(ctx context.Context, file, message string) error {
+	if err := runGit(ctx, "", "add", "--", file); err != nil {
+		return err
+	}
+	return runGit(ctx, message, "commit", "--file=-", "--cleanup=whitespace", "--", file)
+}
+
+// CreateTag creates the annotated tag on HEAD with the git binary, signed if tag.gpgSign is set.
+func CreateTag(ctx context.Context, name, message string) error {
+	return runGit(ctx, message, "tag", "--annotate", "--file=-", "--cleanup=whitespace", name)
+}
+
+// runGit runs the git binary in the current directory, with the input. Its output, like the one of the hooks, is
+// printed to the error output.
+func runGit(ctx context.Context, input string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout = ui.Stderr
+	cmd.Stderr = ui.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return nil
+}
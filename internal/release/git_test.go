@@ -0,0 +1,80 @@
+package release
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommitChangelogAndCreateTag(t *testing.T) {
+	if err := CheckGit(); err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(dir, "no-global-config"))
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	write := func(file, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	git("config", "user.name", "Dague")
+	git("config", "user.email", "dague@example.com")
+	write("main.go", "package main\n")
+	git("add", "-A")
+	git("commit", "-q", "-m", "feat: first")
+	// the hooks of the repository run
+	write(filepath.Join(".git", "hooks", "pre-commit"), "#!/bin/sh\ntouch \"$(git rev-parse --git-dir)/pre-commit-ran\"\n")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+
+	write("CHANGELOG.md", "## 1.0.0\n\n### Features\n\n- first\n")
+	write("main.go", "package main\n\nfunc main() {}\n")
+	if err := CommitChangelog(context.Background(), "CHANGELOG.md", "chore(release): v1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if got := git("show", "--format=%s", "--name-only", "HEAD"); got != "chore(release): v1.0.0\n\nCHANGELOG.md" {
+		t.Errorf("expected the commit to only add the changelog, got %q", got)
+	}
+	if got := git("status", "--porcelain"); got != "M main.go" {
+		t.Errorf("expected the other changes to be kept, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git", "pre-commit-ran")); err != nil {
+		t.Errorf("expected the pre-commit hook to run: %v", err)
+	}
+
+	if err := CreateTag(context.Background(), "v1.0.0", "## 1.0.0\n\n### Features\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got := git("cat-file", "-t", "v1.0.0"); got != "tag" {
+		t.Errorf("expected an annotated tag, got %s", got)
+	}
+	if got := git("tag", "-l", "--format=%(contents)", "v1.0.0"); got != "## 1.0.0\n\n### Features" {
+		t.Errorf("expected the changelog section as tag message, got %q", got)
+	}
+	if err := CreateTag(context.Background(), "v1.0.0", "again"); err == nil {
+		t.Error("expected an error creating an existing tag")
+	}
+}
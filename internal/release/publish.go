@@ -0,0 +1,188 @@
+package release
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+var (
+	//go:embed homebrew.rb.tmpl
+	homebrewTemplate string
+	//go:embed scoop.json.tmpl
+	scoopTemplate string
+)
+
+// Builtin templates of the publishers, used when no custom template is configured.
+const (
+	Homebrew = "homebrew"
+	Scoop    = "scoop"
+)
+
+// File is a released binary, with its download URL and digest.
+type File struct {
+	// File is the name of the binary.
+	File    string
+	OS      string
+	Arch    string
+	Variant string
+	URL     string
+	SHA256  string
+}
+
+// Publication is the data used to render the publishers templates.
+type Publication struct {
+	Name        string
+	Description string
+	Homepage    string
+	License     string
+	Version     string
+	Tag         string
+	All         []File
+}
+
+// Files returns the files of the operating system, restricted to the listed architectures if any. There is one file
+// per architecture: with several variants, like amd64 and amd64/v3, the baseline one, with the lowest variant, is kept.
+func (p Publication) Files(os string, archs ...string) []File {
+	var files []File
+	index := map[string]int{}
+	for _, f := range p.All {
+		if f.OS != os || (len(archs) > 0 && !contains(archs, f.Arch)) {
+			continue
+		}
+		i, ok := index[f.Arch]
+		switch {
+		case !ok:
+			index[f.Arch] = len(files)
+			files = append(files, f)
+		case f.Variant < files[i].Variant:
+			files[i] = f
+		}
+	}
+	return files
+}
+
+// ClassName is the name converted to a Ruby class name, as expected by Homebrew: "my-tool" becomes "MyTool".
+func (p Publication) ClassName() string {
+	var b strings.Builder
+	upper := true
+	for _, r := range p.Name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"rubyString": rubyString,
+}
+
+// rubyString quotes s as a Ruby double-quoted string: the backslashes, quotes and # starting an interpolation are
+// escaped, like the control characters.
+func rubyString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\\', '"', '#':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < ' ' || r == 0x7f {
+				_, _ = fmt.Fprintf(&b, `\x%02x`, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// URLTemplate parses the pattern of the download URLs. Fields are the ones of File plus Version and Tag.
+func URLTemplate(pattern string) (*template.Template, error) {
+	tmpl, err := template.New("url").Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid publishers url: %w", err)
+	}
+	return tmpl, nil
+}
+
+// URL renders the download URL of the file.
+func URL(tmpl *template.Template, version, tag string, f File) (string, error) {
+	var b strings.Builder
+	err := tmpl.Execute(&b, map[string]string{
+		"Version": version,
+		"Tag":     tag,
+		"File":    f.File,
+		"OS":      f.OS,
+		"Arch":    f.Arch,
+		"Variant": f.Variant,
+	})
+	return b.String(), err
+}
+
+// Publish renders the template of a publisher and writes it to the output file. The custom template file is used if
+// set, otherwise the builtin one.
+func Publish(builtin, custom, output string, p Publication) error {
+	text := map[string]string{Homebrew: homebrewTemplate, Scoop: scoopTemplate}[builtin]
+	if custom != "" {
+		b, err := os.ReadFile(custom)
+		if err != nil {
+			return fmt.Errorf("could not read %s template: %w", builtin, err)
+		}
+		text = string(b)
+	}
+	tmpl, err := template.New(builtin).Funcs(funcs).Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid %s template: %w", builtin, err)
+	}
+
+	sort.Slice(p.All, func(i, j int) bool {
+		a, b := p.All[i], p.All[j]
+		return a.OS+"/"+a.Arch+"/"+a.Variant < b.OS+"/"+b.Arch+"/"+b.Variant
+	})
+	var b strings.Builder
+	if err := tmpl.Execute(&b, p); err != nil {
+		return fmt.Errorf("could not render %s template: %w", builtin, err)
+	}
+
+	if dir := filepath.Dir(output); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(output, []byte(b.String()), 0o644)
+}
+
+// WriteChecksums writes the sha256 digests of the files, in the format of the sha256sum tool.
+func WriteChecksums(output string, files []File) error {
+	var b strings.Builder
+	for _, f := range files {
+		_, _ = fmt.Fprintf(&b, "%s  %s\n", f.SHA256, f.File)
+	}
+	return os.WriteFile(output, []byte(b.String()), 0o644)
+}
@@ -0,0 +1,70 @@
+package release
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRubyString(t *testing.T) {
+	tests := map[string]string{
+		"plain":                   `"plain"`,
+		`say "hi"`:                `"say \"hi\""`,
+		`#{system("id")}`:         `"\#{system(\"id\")}"`,
+		`C:\tools`:                `"C:\\tools"`,
+		"two\nlines":              `"two\nlines"`,
+		"https://example.com/a#b": `"https://example.com/a\#b"`,
+	}
+	for s, want := range tests {
+		if got := rubyString(s); got != want {
+			t.Errorf("rubyString(%q): expected %s, got %s", s, want, got)
+		}
+	}
+}
+
+func TestPublishVariants(t *testing.T) {
+	p := Publication{
+		Name:        "app",
+		Description: `The "app" #{tool}`,
+		Version:     "1.2.0",
+		All: []File{
+			{File: "app_linux_amd64_v3", OS: "linux", Arch: "amd64", Variant: "v3", SHA256: "v3"},
+			{File: "app_linux_amd64", OS: "linux", Arch: "amd64", SHA256: "baseline"},
+			{File: "app_linux_arm64", OS: "linux", Arch: "arm64", SHA256: "arm64"},
+			{File: "app_windows_amd64_v3.exe", OS: "windows", Arch: "amd64", Variant: "v3", SHA256: "v3"},
+			{File: "app_windows_amd64_v2.exe", OS: "windows", Arch: "amd64", Variant: "v2", SHA256: "v2"},
+		},
+	}
+	dir := t.TempDir()
+
+	formula := filepath.Join(dir, "app.rb")
+	if err := Publish(Homebrew, "", formula, p); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(formula)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb := string(b)
+	if n := strings.Count(rb, "Hardware::CPU.intel?"); n != 1 {
+		t.Errorf("expected one intel block, got %d:\n%s", n, rb)
+	}
+	if !strings.Contains(rb, `sha256 "baseline"`) || strings.Contains(rb, `sha256 "v3"`) {
+		t.Errorf("expected the baseline amd64 binary:\n%s", rb)
+	}
+	if !strings.Contains(rb, `desc "The \"app\" \#{tool}"`) {
+		t.Errorf("expected the description to be escaped:\n%s", rb)
+	}
+
+	manifest := filepath.Join(dir, "app.json")
+	if err := Publish(Scoop, "", manifest, p); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = os.ReadFile(manifest); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), `"64bit"`); n != 1 || !strings.Contains(string(b), `"hash": "v2"`) {
+		t.Errorf("expected only the lowest amd64 variant:\n%s", b)
+	}
+}
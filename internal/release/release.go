@@ -0,0 +1,159 @@
+package release
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/eunomie/dague/internal/git"
+	"github.com/eunomie/dague/internal/semver"
+)
+
+// CommitType and CommitScope are the type and scope of the commits of the changelog, like chore(release): v1.2.0.
+// They are not part of the next changelogs.
+const (
+	CommitType  = "chore"
+	CommitScope = "release"
+)
+
+// Change is a commit following the conventional commits specification, see https://www.conventionalcommits.org.
+type Change struct {
+	Type        string
+	Scope       string
+	Description string
+	Breaking    bool
+	Commit      string
+}
+
+var conventionalRegexp = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?: (.+)$`)
+
+// ParseCommit parses a commit message. Commits not following the conventional commits have no type.
+func ParseCommit(c git.Commit) Change {
+	change := Change{
+		Description: c.Subject(),
+		Commit:      c.Hash.String()[:7],
+	}
+	if m := conventionalRegexp.FindStringSubmatch(c.Subject()); m != nil {
+		change.Type = strings.ToLower(m[1])
+		change.Scope = m[2]
+		change.Breaking = m[3] == "!"
+		change.Description = m[4]
+	}
+	for _, line := range strings.Split(c.Body(), "\n") {
+		if strings.HasPrefix(line, "BREAKING CHANGE:") || strings.HasPrefix(line, "BREAKING-CHANGE:") {
+			change.Breaking = true
+		}
+	}
+	return change
+}
+
+// NextVersion computes the next version. With the auto bump, the version is bumped depending on the changes: major
+// for breaking changes, minor for features, patch otherwise.
+func NextVersion(current semver.Version, bump string, changes []Change) (semver.Version, error) {
+	if bump == "auto" {
+		bump = "patch"
+		for _, c := range changes {
+			if c.Breaking {
+				bump = "major"
+				break
+			}
+			if c.Type == "feat" {
+				bump = "minor"
+			}
+		}
+	}
+	switch bump {
+	case "major":
+		return current.IncMajor(), nil
+	case "minor":
+		return current.IncMinor(), nil
+	case "patch":
+		return current.IncPatch(), nil
+	}
+	return semver.Version{}, fmt.Errorf("invalid bump %q, must be major, minor, patch or auto", bump)
+}
+
+// sections are the groups of the changelog, by commit type. Other types go to the last section.
+var sections = []struct {
+	title string
+	types []string
+}{
+	{"Features", []string{"feat"}},
+	{"Bug Fixes", []string{"fix"}},
+	{"Performance Improvements", []string{"perf"}},
+	{"Reverts", []string{"revert"}},
+	{"Documentation", []string{"docs"}},
+	{"Other Changes", nil},
+}
+
+// Changelog renders the changelog section of a version, with the changes grouped by type.
+func Changelog(version string, date time.Time, changes []Change) string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "## %s (%s)\n", version, date.Format("2006-01-02"))
+
+	var breaking []Change
+	for _, c := range changes {
+		if c.Breaking {
+			breaking = append(breaking, c)
+		}
+	}
+	writeSection(&b, "Breaking Changes", breaking)
+
+	known := map[string]bool{}
+	for _, s := range sections {
+		for _, t := range s.types {
+			known[t] = true
+		}
+	}
+	for _, s := range sections {
+		var grouped []Change
+		for _, c := range changes {
+			if (s.types == nil && !known[c.Type]) || contains(s.types, c.Type) {
+				grouped = append(grouped, c)
+			}
+		}
+		writeSection(&b, s.title, grouped)
+	}
+	return b.String()
+}
+
+func writeSection(b *strings.Builder, title string, changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(b, "\n### %s\n\n", title)
+	for _, c := range changes {
+		if c.Scope != "" {
+			_, _ = fmt.Fprintf(b, "- **%s:** %s (%s)\n", c.Scope, c.Description, c.Commit)
+		} else {
+			_, _ = fmt.Fprintf(b, "- %s (%s)\n", c.Description, c.Commit)
+		}
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+const changelogTitle = "# Changelog\n"
+
+// PrependChangelog adds the section at the top of the changelog file, after its title, creating it if needed.
+func PrependChangelog(file, section string) error {
+	content, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	existing := strings.TrimPrefix(string(content), changelogTitle)
+	updated := changelogTitle + "\n" + section
+	if rest := strings.TrimSpace(existing); rest != "" {
+		updated += "\n" + rest + "\n"
+	}
+	return os.WriteFile(file, []byte(updated), 0o644)
+}
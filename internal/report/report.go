@@ -0,0 +1,221 @@
+package report
+
+import (
+	"debug/buildinfo"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/eunomie/dague/types"
+)
+
+type (
+	// Report describes the artifacts generated by a build.
+	Report struct {
+		Artifacts []Artifact `json:"artifacts"`
+	}
+
+	// Release is the release.json manifest written by go:release: the version and the report of the released artifacts,
+	// with their digests. As it contains the artifacts like a report, it can be used as the base of a report.
+	Release struct {
+		Version string `json:"version"`
+		Tag     string `json:"tag"`
+		Report
+	}
+
+	// Artifact contains the size and build information of a binary, as reported by go version -m.
+	Artifact struct {
+		Target    string   `json:"target"`
+		Path      string   `json:"path"`
+		Platform  string   `json:"platform"`
+		Size      int64    `json:"size"`
+		GoVersion string   `json:"goVersion,omitempty"`
+		Main      Module   `json:"main,omitempty"`
+		Revision  string   `json:"revision,omitempty"`
+		Modified  bool     `json:"modified,omitempty"`
+		Modules   []Module `json:"modules,omitempty"`
+		// SHA256 is the digest of the artifact, set in the release manifest.
+		SHA256 string `json:"sha256,omitempty"`
+	}
+
+	Module struct {
+		Path    string `json:"path"`
+		Version string `json:"version"`
+	}
+)
+
+// New creates the report of the artifacts, reading the build information embedded in the binaries.
+// Artifacts without build information, like C archives, only report their size.
+func New(artifacts []types.Artifact) (Report, error) {
+	var r Report
+	for _, a := range artifacts {
+		stat, err := os.Stat(a.Path)
+		if err != nil {
+			return Report{}, err
+		}
+		artifact := Artifact{
+			Target:   a.Target,
+			Path:     a.Path,
+			Platform: a.Platform.String(),
+			Size:     stat.Size(),
+		}
+		if info, err := buildinfo.ReadFile(a.Path); err == nil {
+			artifact.GoVersion = info.GoVersion
+			artifact.Main = Module{Path: info.Main.Path, Version: info.Main.Version}
+			for _, setting := range info.Settings {
+				switch setting.Key {
+				case "vcs.revision":
+					artifact.Revision = setting.Value
+				case "vcs.modified":
+					artifact.Modified = setting.Value == "true"
+				}
+			}
+			for _, dep := range info.Deps {
+				if dep.Replace != nil {
+					dep = dep.Replace
+				}
+				artifact.Modules = append(artifact.Modules, Module{Path: dep.Path, Version: dep.Version})
+			}
+		}
+		r.Artifacts = append(r.Artifacts, artifact)
+	}
+	return r, nil
+}
+
+// Load reads a report previously saved as JSON, or the report of the artifacts of a release.json manifest.
+func Load(file string) (Report, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Report{}, fmt.Errorf("could not read report: %w", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Report{}, fmt.Errorf("could not parse report %s: %w", file, err)
+	}
+	if _, ok := fields["artifacts"]; !ok {
+		return Report{}, fmt.Errorf("%s is not a saved report nor a release.json manifest, it has no artifacts", file)
+	}
+	var r Release
+	if err := json.Unmarshal(data, &r); err != nil {
+		return Report{}, fmt.Errorf("could not parse report %s: %w", file, err)
+	}
+	return r.Report, nil
+}
+
+// Save writes the report as JSON.
+func (r Report) Save(file string) error {
+	return save(file, r)
+}
+
+// Save writes the release manifest as JSON.
+func (r Release) Save(file string) error {
+	return save(file, r)
+}
+
+func save(file string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0o644)
+}
+
+// Print writes a human-readable version of the report.
+func (r Report) Print(w io.Writer) {
+	for _, a := range r.Artifacts {
+		_, _ = fmt.Fprintf(w, "%s (%s)\n", a.Path, a.Platform)
+		_, _ = fmt.Fprintf(w, "  size:     %s\n", HumanSize(a.Size))
+		if a.GoVersion == "" {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "  go:       %s\n", a.GoVersion)
+		_, _ = fmt.Fprintf(w, "  module:   %s %s\n", a.Main.Path, a.Main.Version)
+		if a.Revision != "" {
+			modified := ""
+			if a.Modified {
+				modified = " (modified)"
+			}
+			_, _ = fmt.Fprintf(w, "  revision: %s%s\n", a.Revision, modified)
+		}
+		if len(a.Modules) > 0 {
+			_, _ = fmt.Fprintln(w, "  modules:")
+			for _, m := range a.Modules {
+				_, _ = fmt.Fprintf(w, "    %s %s\n", m.Path, m.Version)
+			}
+		}
+	}
+}
+
+// Diff writes the size deltas and the added, removed and upgraded modules of the artifacts compared to the base
+// report. Artifacts are matched by target and platform, as their paths can change between versions.
+func Diff(w io.Writer, base, current Report) {
+	baseArtifacts := map[string]Artifact{}
+	for _, a := range base.Artifacts {
+		baseArtifacts[a.Target+" "+a.Platform] = a
+	}
+
+	for _, a := range current.Artifacts {
+		b, ok := baseArtifacts[a.Target+" "+a.Platform]
+		if !ok {
+			_, _ = fmt.Fprintf(w, "%s (%s): new artifact, %s\n", a.Path, a.Platform, HumanSize(a.Size))
+			continue
+		}
+		delta := a.Size - b.Size
+		sign := "+"
+		if delta < 0 {
+			sign = "-"
+			delta = -delta
+		}
+		_, _ = fmt.Fprintf(w, "%s (%s): %s -> %s (%s%s)\n",
+			a.Path, a.Platform, HumanSize(b.Size), HumanSize(a.Size), sign, HumanSize(delta))
+		if b.GoVersion != a.GoVersion {
+			_, _ = fmt.Fprintf(w, "  ~ go %s -> %s\n", b.GoVersion, a.GoVersion)
+		}
+
+		baseModules := map[string]string{}
+		for _, m := range b.Modules {
+			baseModules[m.Path] = m.Version
+		}
+		modules := map[string]string{}
+		for _, m := range a.Modules {
+			modules[m.Path] = m.Version
+		}
+		var changes []string
+		for path, version := range modules {
+			baseVersion, ok := baseModules[path]
+			switch {
+			case !ok:
+				changes = append(changes, fmt.Sprintf("  + %s %s", path, version))
+			case baseVersion != version:
+				changes = append(changes, fmt.Sprintf("  ~ %s %s -> %s", path, baseVersion, version))
+			}
+		}
+		for path, version := range baseModules {
+			if _, ok := modules[path]; !ok {
+				changes = append(changes, fmt.Sprintf("  - %s %s", path, version))
+			}
+		}
+		sort.Slice(changes, func(i, j int) bool {
+			return changes[i][4:] < changes[j][4:]
+		})
+		for _, c := range changes {
+			_, _ = fmt.Fprintln(w, c)
+		}
+	}
+}
+
+// HumanSize formats a size in bytes using binary units.
+func HumanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
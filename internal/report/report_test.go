@@ -0,0 +1,64 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	artifacts := []Artifact{{
+		Target:    "cross",
+		Path:      "dist/app_linux_amd64",
+		Platform:  "linux/amd64",
+		Size:      1024,
+		GoVersion: "go1.19.5",
+		Modules:   []Module{{Path: "golang.org/x/mod", Version: "v0.8.0"}},
+	}}
+	dir := t.TempDir()
+
+	saved := filepath.Join(dir, "report.json")
+	if err := (Report{Artifacts: artifacts}).Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	manifest := filepath.Join(dir, "release.json")
+	released := append([]Artifact{}, artifacts...)
+	released[0].SHA256 = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	if err := (Release{Version: "1.2.0", Tag: "v1.2.0", Report: Report{Artifacts: released}}).Save(manifest); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "other.json")
+	if err := os.WriteFile(other, []byte(`{"name": "app"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		file string
+		want []Artifact
+		err  bool
+	}{
+		{name: "saved report", file: saved, want: artifacts},
+		{name: "release manifest", file: manifest, want: released},
+		{name: "other json", file: other, err: true},
+		{name: "missing", file: filepath.Join(dir, "missing.json"), err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Load(tt.file)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", r)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(r.Artifacts, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, r.Artifacts)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package scaffold
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+//go:embed dague.yml.tmpl
+var configTemplate string
+
+type (
+	// Project describes what is detected in a repository to generate its configuration.
+	Project struct {
+		// Module is the module path of go.mod.
+		Module string
+		// GoVersion is the go directive of go.mod.
+		GoVersion string
+		// Golangci is the golangci-lint configuration file, if any.
+		Golangci string
+		Mains    []Main
+		// MakeTargets are the targets of the Makefile.
+		MakeTargets []string
+	}
+
+	// Main is a main package, to build as a target.
+	Main struct {
+		Name string
+		Path string
+	}
+)
+
+var golangciFiles = []string{".golangci.yml", ".golangci.yaml", ".golangci.toml", ".golangci.json"}
+
+// Inspect detects the go.mod Go version, the main packages, the golangci-lint configuration and the Makefile targets
+// of the project in dir.
+func Inspect(dir string) (Project, error) {
+	var p Project
+	if err := p.readGoMod(filepath.Join(dir, "go.mod")); err != nil {
+		return Project{}, err
+	}
+	for _, f := range golangciFiles {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			p.Golangci = f
+			break
+		}
+	}
+	if err := p.findMains(dir); err != nil {
+		return Project{}, err
+	}
+	if err := p.readMakefile(filepath.Join(dir, "Makefile")); err != nil {
+		return Project{}, err
+	}
+	return p, nil
+}
+
+func (p *Project) readGoMod(file string) error {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "module":
+			p.Module = strings.Trim(fields[1], `"`)
+		case "go":
+			p.GoVersion = fields[1]
+		}
+	}
+	return nil
+}
+
+// findMains walks the project for main packages, skipping hidden directories, vendor and testdata, like the go tool.
+func (p *Project) findMains(dir string) error {
+	names := map[string]int{}
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		if file != dir && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+			return filepath.SkipDir
+		}
+		isMain, err := isMainPackage(file)
+		if err != nil || !isMain {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		targetName := filepath.Base(rel)
+		if rel == "." {
+			targetName = path.Base(p.Module)
+			if p.Module == "" {
+				targetName = filepath.Base(dir)
+			}
+		}
+		if names[targetName]++; names[targetName] > 1 {
+			targetName = strings.ReplaceAll(filepath.ToSlash(rel), "/", "-")
+		}
+		p.Mains = append(p.Mains, Main{Name: targetName, Path: "./" + filepath.ToSlash(rel)})
+		return nil
+	})
+	return err
+}
+
+func isMainPackage(dir string) (bool, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return false, err
+	}
+	fset := token.NewFileSet()
+	for _, f := range files {
+		if strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, f, nil, parser.PackageClauseOnly)
+		if err != nil {
+			continue
+		}
+		if file.Name.Name == "main" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+var makeTargetRegexp = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_.-]*)\s*:([^=]|$)`)
+
+func (p *Project) readMakefile(file string) error {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		m := makeTargetRegexp.FindStringSubmatch(scanner.Text())
+		if m == nil || seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		p.MakeTargets = append(p.MakeTargets, m[1])
+	}
+	return scanner.Err()
+}
+
+// Render generates the commented configuration of the project.
+func Render(p Project) ([]byte, error) {
+	tmpl, err := template.New("dague.yml").Parse(configTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, p); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
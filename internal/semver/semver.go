@@ -0,0 +1,128 @@
+package semver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version, see https://semver.org.
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	Build      string
+}
+
+var semverRegexp = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z.-]+))?(?:\+([0-9A-Za-z.-]+))?$`)
+
+// Parse parses a semantic version, with an optional v prefix as commonly used in git tags.
+func Parse(s string) (Version, error) {
+	m := semverRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("invalid semantic version %q", s)
+	}
+	var v Version
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	v.Prerelease = m[4]
+	v.Build = m[5]
+	return v, nil
+}
+
+// String returns the version without v prefix.
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 depending on v being lower, equal or greater than o. Build metadata is ignored.
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+func comparePrerelease(a, b string) int {
+	// a version without prerelease has a higher precedence
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			// numeric identifiers have a lower precedence
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// IncMajor returns the next major version. The next major version of a major prerelease, like 2.0.0-rc.1, is its
+// release, 2.0.0.
+func (v Version) IncMajor() Version {
+	if v.Prerelease != "" && v.Minor == 0 && v.Patch == 0 {
+		return Version{Major: v.Major}
+	}
+	return Version{Major: v.Major + 1}
+}
+
+// IncMinor returns the next minor version. The next minor version of a minor prerelease, like 1.1.0-rc.1, is its
+// release, 1.1.0.
+func (v Version) IncMinor() Version {
+	if v.Prerelease != "" && v.Patch == 0 {
+		return Version{Major: v.Major, Minor: v.Minor}
+	}
+	return Version{Major: v.Major, Minor: v.Minor + 1}
+}
+
+// IncPatch returns the next patch version. The next patch version of a prerelease, like 1.0.1-rc.1, is its release,
+// 1.0.1.
+func (v Version) IncPatch() Version {
+	if v.Prerelease != "" {
+		return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+	}
+	return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+}
@@ -0,0 +1,38 @@
+package semver
+
+import (
+	"testing"
+)
+
+func TestInc(t *testing.T) {
+	tests := []struct {
+		version string
+		major   string
+		minor   string
+		patch   string
+	}{
+		{version: "0.0.0", major: "1.0.0", minor: "0.1.0", patch: "0.0.1"},
+		{version: "1.2.3", major: "2.0.0", minor: "1.3.0", patch: "1.2.4"},
+		{version: "1.2.3+build", major: "2.0.0", minor: "1.3.0", patch: "1.2.4"},
+		{version: "1.0.0-rc.1", major: "1.0.0", minor: "1.0.0", patch: "1.0.0"},
+		{version: "1.1.0-rc.1", major: "2.0.0", minor: "1.1.0", patch: "1.1.0"},
+		{version: "1.1.1-rc.1", major: "2.0.0", minor: "1.2.0", patch: "1.1.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			v, err := Parse(tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := v.IncMajor().String(); got != tt.major {
+				t.Errorf("IncMajor: expected %s, got %s", tt.major, got)
+			}
+			if got := v.IncMinor().String(); got != tt.minor {
+				t.Errorf("IncMinor: expected %s, got %s", tt.minor, got)
+			}
+			if got := v.IncPatch().String(); got != tt.patch {
+				t.Errorf("IncPatch: expected %s, got %s", tt.patch, got)
+			}
+		})
+	}
+}
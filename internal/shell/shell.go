@@ -3,6 +3,7 @@ package shell
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -13,8 +14,34 @@ import (
 	"mvdan.cc/sh/v3/expand"
 	"mvdan.cc/sh/v3/interp"
 	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/eunomie/dague/internal/ui"
 )
 
+// hiddenEnv are the prefixes of the environment variables holding the secrets given to the dagger engine, like
+// DAGUE_SECRET_TOKEN or DAGUE_NETRC. They are removed from the environment of the scripts and of the expansions.
+var hiddenEnv = []string{"DAGUE_SECRET_", "DAGUE_NETRC"}
+
+// environ returns the environment of the process, without the hidden variables.
+func environ() []string {
+	var pairs []string
+	for _, p := range os.Environ() {
+		if !hidden(p) {
+			pairs = append(pairs, p)
+		}
+	}
+	return pairs
+}
+
+func hidden(name string) bool {
+	for _, prefix := range hiddenEnv {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func Interpret(ctx context.Context, cmd string, env map[string]string) (string, error) {
 	out := bytes.NewBufferString("")
 
@@ -26,7 +53,7 @@ func Interpret(ctx context.Context, cmd string, env map[string]string) (string,
 }
 
 func Run(ctx context.Context, cmd string, env map[string]string) error {
-	return interpret(ctx, cmd, env, os.Stdout, os.Stderr)
+	return interpret(ctx, cmd, env, ui.Stdout, ui.Stderr)
 }
 
 func interpret(ctx context.Context, cmd string, env map[string]string, outWriter, errWriter io.Writer) error {
@@ -35,7 +62,7 @@ func interpret(ctx context.Context, cmd string, env map[string]string, outWriter
 		return err
 	}
 
-	pairs := os.Environ()
+	pairs := environ()
 	for k, v := range env {
 		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
 	}
@@ -54,6 +81,60 @@ func Expand(s string, env map[string]string) (string, error) {
 				return v
 			}
 		}
+		if hidden(name) {
+			return ""
+		}
 		return os.Getenv(name)
 	})
 }
+
+// ExpandStrict expands the variables of s like Expand, but reports an error for undefined variables, unless they have
+// a default value, like ${VAR:-default}. Variables set to an empty value are defined.
+func ExpandStrict(s string, env map[string]string) (string, error) {
+	word, err := syntax.NewParser().Document(strings.NewReader(s))
+	if err != nil {
+		return "", err
+	}
+	pairs := environ()
+	for k, v := range env {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	cfg := &expand.Config{Env: expand.ListEnviron(pairs...), NoUnset: true}
+	res, err := expand.Document(cfg, word)
+	var unset expand.UnsetParameterError
+	if errors.As(err, &unset) {
+		return "", fmt.Errorf("undefined variable %s", unset.Node.Param.Value)
+	}
+	return res, err
+}
+
+// ScriptVars returns the names of the variables referenced by the shell script.
+func ScriptVars(cmd string) ([]string, error) {
+	script, err := syntax.NewParser().Parse(strings.NewReader(cmd), "")
+	if err != nil {
+		return nil, err
+	}
+	return paramNames(script), nil
+}
+
+// Vars returns the names of the variables referenced by the string, as expanded by Expand.
+func Vars(s string) ([]string, error) {
+	word, err := syntax.NewParser().Document(strings.NewReader(s))
+	if err != nil {
+		return nil, err
+	}
+	return paramNames(word), nil
+}
+
+func paramNames(node syntax.Node) []string {
+	var names []string
+	seen := map[string]bool{}
+	syntax.Walk(node, func(n syntax.Node) bool {
+		if p, ok := n.(*syntax.ParamExp); ok && p.Param != nil && !seen[p.Param.Value] {
+			seen[p.Param.Value] = true
+			names = append(names, p.Param.Value)
+		}
+		return true
+	})
+	return names
+}
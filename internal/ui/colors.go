@@ -109,6 +109,8 @@ func isTerminal(w io.Writer) bool {
 	}
 
 	switch v := w.(type) {
+	case *maskWriter:
+		return isTerminal(v.out)
 	case *os.File:
 		return term.IsTerminal(int(v.Fd()))
 	default:
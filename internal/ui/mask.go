@@ -0,0 +1,126 @@
+package ui
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Stdout and Stderr are the outputs of dague. Once registered with Mask, secrets are masked from them.
+var (
+	Stdout io.Writer = os.Stdout
+	Stderr io.Writer = os.Stderr
+)
+
+// ErrOut writes to Stderr. It can be given to the writers set before the secrets are registered, like the error output
+// of the commands, as the secrets are masked from it once registered.
+var ErrOut io.Writer = writerFunc(func(p []byte) (int, error) {
+	return Stderr.Write(p)
+})
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+const masked = "***"
+
+// Mask replaces the secrets by *** in everything written to Stdout and Stderr. Each line of a multi-line secret, like
+// a PEM key, is also masked, as the lines can be printed separately.
+func Mask(secrets ...string) {
+	var values [][]byte
+	for _, s := range secrets {
+		if s != "" {
+			values = append(values, []byte(s))
+		}
+		if !strings.Contains(s, "\n") {
+			continue
+		}
+		for _, line := range strings.Split(s, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				values = append(values, []byte(line))
+			}
+		}
+	}
+	if len(values) == 0 {
+		return
+	}
+	Stdout = mask(Stdout, values)
+	Stderr = mask(Stderr, values)
+}
+
+// Flush writes the data kept by the masking of Stdout and Stderr, as the beginning of a secret, that no other write
+// will complete. It must be called before exiting.
+func Flush() {
+	for _, w := range []io.Writer{Stdout, Stderr} {
+		if m, ok := w.(*maskWriter); ok {
+			_ = m.Flush()
+		}
+	}
+}
+
+func mask(w io.Writer, secrets [][]byte) io.Writer {
+	if m, ok := w.(*maskWriter); ok {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.secrets = append(m.secrets, secrets...)
+		return m
+	}
+	return &maskWriter{out: w, secrets: secrets}
+}
+
+// maskWriter replaces the secrets by *** before writing to out. As a secret can be split across writes, the end of
+// the written data that could be the beginning of a secret is kept until the next write.
+type maskWriter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	secrets [][]byte
+	pending []byte
+}
+
+func (m *maskWriter) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data := append(m.pending, p...)
+	for _, s := range m.secrets {
+		data = bytes.ReplaceAll(data, s, []byte(masked))
+	}
+	keep := m.partialSecret(data)
+	m.pending = append([]byte{}, data[len(data)-keep:]...)
+	if _, err := m.out.Write(data[:len(data)-keep]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes the pending data.
+func (m *maskWriter) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data := m.pending
+	m.pending = nil
+	if len(data) == 0 {
+		return nil
+	}
+	_, err := m.out.Write(data)
+	return err
+}
+
+// partialSecret returns the length of the longest end of data that is the beginning of a secret.
+func (m *maskWriter) partialSecret(data []byte) int {
+	longest := 0
+	for _, s := range m.secrets {
+		for n := len(s) - 1; n > longest; n-- {
+			if n <= len(data) && bytes.HasSuffix(data, s[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
@@ -1,15 +1,24 @@
 package ui
 
 import (
+	"errors"
+	"os"
 	"sort"
 
 	"github.com/AlecAivazis/survey/v2"
 )
 
+// Interactive allows to ask the user to choose. If disabled, Select and MultiSelect fail unless there's only one option.
+var Interactive = true
+
+// Select asks to choose one option. It requires a terminal, unless there's only one option.
 func Select(msg string, options []string) (string, error) {
 	if len(options) == 1 {
 		return options[0], nil
 	}
+	if err := canAsk(); err != nil {
+		return "", err
+	}
 	opts := append([]string{}, options...)
 	sort.Strings(opts)
 	qs := &survey.Select{
@@ -20,3 +29,32 @@ func Select(msg string, options []string) (string, error) {
 	err := survey.AskOne(qs, &selected, nil)
 	return selected, err
 }
+
+// MultiSelect asks to choose one or more options. It requires a terminal, unless there's only one option.
+func MultiSelect(msg string, options []string) ([]string, error) {
+	if len(options) == 1 {
+		return options, nil
+	}
+	if err := canAsk(); err != nil {
+		return nil, err
+	}
+	opts := append([]string{}, options...)
+	sort.Strings(opts)
+	qs := &survey.MultiSelect{
+		Message: msg,
+		Options: opts,
+	}
+	var selected []string
+	err := survey.AskOne(qs, &selected, nil)
+	return selected, err
+}
+
+func canAsk() error {
+	if !Interactive {
+		return errors.New("interactive selection is disabled by the configuration")
+	}
+	if !IsTerminal(os.Stdin) {
+		return errors.New("not running in a terminal")
+	}
+	return nil
+}
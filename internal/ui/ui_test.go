@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"io"
+	"testing"
+)
+
+func TestSelectWithoutAsking(t *testing.T) {
+	tests := []struct {
+		name        string
+		interactive bool
+		terminal    bool
+		options     []string
+		want        string
+		wantErr     string
+	}{
+		{
+			name:        "single option",
+			interactive: false,
+			terminal:    false,
+			options:     []string{"one"},
+			want:        "one",
+		},
+		{
+			name:        "not a terminal",
+			interactive: true,
+			terminal:    false,
+			options:     []string{"one", "two"},
+			wantErr:     "not running in a terminal",
+		},
+		{
+			name:        "disabled",
+			interactive: false,
+			terminal:    true,
+			options:     []string{"one", "two"},
+			wantErr:     "interactive selection is disabled by the configuration",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interactive, isTerminal := Interactive, IsTerminal
+			defer func() { Interactive, IsTerminal = interactive, isTerminal }()
+			Interactive = tt.interactive
+			IsTerminal = func(io.Writer) bool { return tt.terminal }
+
+			got, err := Select("Choose:", tt.options)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil || got != tt.want {
+				t.Fatalf("expected %q, got %q (%v)", tt.want, got, err)
+			}
+
+			multi, err := MultiSelect("Choose:", tt.options)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil || len(multi) != 1 || multi[0] != tt.want {
+				t.Fatalf("expected [%q], got %q (%v)", tt.want, multi, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// Module is a Go module of the project.
+type Module struct {
+	// Dir is the directory of the module, relative to the root of the project, like . or ./tools.
+	Dir string
+	// Path is the module path of its go.mod.
+	Path string
+}
+
+// Find returns the modules of the project in dir: the ones used by go.work if it exists, or all the directories
+// containing a go.mod file, skipping hidden directories, vendor and testdata like the go tool. Modules are sorted by
+// directory, the root one first. Without any go.mod file, the root directory is the only module.
+func Find(dir string) ([]Module, error) {
+	dirs, err := workDirs(filepath.Join(dir, "go.work"))
+	if err != nil {
+		return nil, err
+	}
+	if dirs == nil {
+		if dirs, err = modDirs(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	var modules []Module
+	for _, d := range dirs {
+		modPath, err := modulePath(filepath.Join(dir, filepath.FromSlash(d), "go.mod"))
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, Module{Dir: d, Path: modPath})
+	}
+	if len(modules) == 0 {
+		return []Module{{Dir: "."}}, nil
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Dir < modules[j].Dir
+	})
+	return modules, nil
+}
+
+// Select returns the modules matching the names, by directory or module path. All the modules are returned without
+// names.
+func Select(modules []Module, names []string) ([]Module, error) {
+	if len(names) == 0 {
+		return modules, nil
+	}
+	var selected []Module
+	for _, name := range names {
+		found := false
+		for _, m := range modules {
+			if m.Path == name || m.Dir == name || m.Dir == "./"+path.Clean(name) {
+				selected = append(selected, m)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown module %q", name)
+		}
+	}
+	return selected, nil
+}
+
+// HasWork reports whether the project in dir has a go.work file.
+func HasWork(dir string) (bool, error) {
+	_, err := os.Stat(filepath.Join(dir, "go.work"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Requirements returns the module versions required by the modules of the workspace, as path@version, to download
+// them without loading the module graph: the go tool would otherwise look up the versions required of the modules of
+// the workspace, that may not be published. The modules of the workspace and the ones replaced by a directory are
+// skipped, the replacements by another module are returned instead of the required version.
+func Requirements(dir string, modules []Module) ([]string, error) {
+	workspace := map[string]bool{}
+	for _, m := range modules {
+		workspace[m.Path] = true
+	}
+
+	// the replacements of go.work apply to all the modules, and win over the ones of the modules
+	replaces := map[module.Version]module.Version{}
+	addReplaces := func(rs []*modfile.Replace, override bool) {
+		for _, r := range rs {
+			if _, ok := replaces[r.Old]; !ok || override {
+				replaces[r.Old] = r.New
+			}
+		}
+	}
+	work, err := parseWork(filepath.Join(dir, "go.work"))
+	if err != nil {
+		return nil, err
+	}
+	if work != nil {
+		addReplaces(work.Replace, true)
+	}
+	var requires []module.Version
+	for _, m := range modules {
+		mod, err := parseMod(filepath.Join(dir, filepath.FromSlash(m.Dir), "go.mod"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		addReplaces(mod.Replace, false)
+		for _, r := range mod.Require {
+			requires = append(requires, r.Mod)
+		}
+	}
+
+	var res []string
+	seen := map[string]bool{}
+	for _, r := range requires {
+		if workspace[r.Path] {
+			continue
+		}
+		replace, ok := replaces[r]
+		if !ok {
+			// a replacement without version applies to all the versions
+			replace, ok = replaces[module.Version{Path: r.Path}]
+		}
+		if ok {
+			if replace.Version == "" {
+				// replaced by a directory
+				continue
+			}
+			r = replace
+		}
+		if m := r.Path + "@" + r.Version; !seen[m] {
+			seen[m] = true
+			res = append(res, m)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// workDirs returns the directories of the use directives of the go.work file, or nil if it doesn't exist. Only the
+// project is mounted in the containers, the directories outside of it are rejected.
+func workDirs(file string) ([]string, error) {
+	work, err := parseWork(file)
+	if err != nil || work == nil {
+		return nil, err
+	}
+	dirs := []string{}
+	for _, use := range work.Use {
+		d := filepath.ToSlash(use.Path)
+		if filepath.IsAbs(use.Path) || path.IsAbs(d) || relDir(d) == ".." || strings.HasPrefix(relDir(d), "../") {
+			return nil, fmt.Errorf("%s:%d: use %s is outside of the project, only the modules of the project are available "+
+				"in the containers", file, use.Syntax.Start.Line, use.Path)
+		}
+		dirs = append(dirs, relDir(d))
+	}
+	return dirs, nil
+}
+
+// parseWork parses the go.work file, or returns nil if it doesn't exist.
+func parseWork(file string) (*modfile.WorkFile, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return modfile.ParseWork(file, data, nil)
+}
+
+// parseMod parses the go.mod file.
+func parseMod(file string) (*modfile.File, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return modfile.Parse(file, data, nil)
+}
+
+// modDirs returns the directories containing a go.mod file.
+func modDirs(dir string) ([]string, error) {
+	var dirs []string
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if file != dir && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "go.mod" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filepath.Dir(file))
+		if err != nil {
+			return err
+		}
+		dirs = append(dirs, relDir(filepath.ToSlash(rel)))
+		return nil
+	})
+	return dirs, err
+}
+
+func relDir(d string) string {
+	d = path.Clean(d)
+	if d == "." || strings.HasPrefix(d, "../") {
+		return d
+	}
+	return "./" + d
+}
+
+func modulePath(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	modPath := modfile.ModulePath(data)
+	if modPath == "" {
+		return "", fmt.Errorf("no module directive in %s", file)
+	}
+	return modPath, nil
+}
@@ -0,0 +1,84 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFindAndRequirements(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.work": `go 1.19
+
+use (
+	.
+	"./tools" // quoted, with a comment
+)
+
+replace example.com/lib v1.0.0 => example.com/fork v1.0.1
+`,
+		"go.mod": `module example.com/app
+
+go 1.19
+
+require (
+	example.com/app/tools v0.0.0
+	example.com/lib v1.0.0
+	example.com/local v1.2.0
+)
+
+replace (
+	example.com/lib => example.com/other v2.0.0
+	example.com/local => ../local
+)
+`,
+		"tools/go.mod": "module example.com/app/tools\n\ngo 1.19\n\nrequire golang.org/x/mod v0.8.0 // indirect\n",
+	})
+
+	modules, err := Find(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Module{{Dir: ".", Path: "example.com/app"}, {Dir: "./tools", Path: "example.com/app/tools"}}
+	if !reflect.DeepEqual(modules, want) {
+		t.Errorf("expected the modules %v, got %v", want, modules)
+	}
+
+	requirements, err := Requirements(dir, modules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the replacement of go.work wins, the module replaced by a directory and the ones of the workspace are skipped
+	if wantReqs := []string{"example.com/fork@v1.0.1", "golang.org/x/mod@v0.8.0"}; !reflect.DeepEqual(requirements, wantReqs) {
+		t.Errorf("expected the requirements %v, got %v", wantReqs, requirements)
+	}
+}
+
+func TestFindUseOutsideProject(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"project/go.work": "go 1.19\n\nuse (\n\t.\n\t../shared\n)\n",
+		"project/go.mod":  "module example.com/app\n",
+		"shared/go.mod":   "module example.com/shared\n",
+	})
+	_, err := Find(filepath.Join(dir, "project"))
+	if err == nil || !strings.Contains(err.Error(), "outside of the project") {
+		t.Errorf("expected the use of ../shared to be rejected, got %v", err)
+	}
+}
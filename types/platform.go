@@ -0,0 +1,99 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParsePlatform parses a platform in the os/arch[/variant] form, like linux/arm/v7.
+func ParsePlatform(s string) (Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Platform{}, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", s)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return Platform{}, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", s)
+		}
+	}
+	p := Platform{OS: parts[0], Arch: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	if _, err := p.Env(); err != nil {
+		return Platform{}, err
+	}
+	return p, nil
+}
+
+// String returns the platform in the os/arch[/variant] form.
+func (p Platform) String() string {
+	if p.Variant == "" {
+		return p.OS + "/" + p.Arch
+	}
+	return p.OS + "/" + p.Arch + "/" + p.Variant
+}
+
+// Env returns the Go environment variables to build for the platform, including the ones mapped from the variant
+// like GOARM, GOAMD64 or GOMIPS.
+func (p Platform) Env() (map[string]string, error) {
+	env := map[string]string{
+		"GOOS":   p.OS,
+		"GOARCH": p.Arch,
+	}
+	if p.Variant == "" {
+		return env, nil
+	}
+
+	switch p.Arch {
+	case "arm":
+		switch p.Variant {
+		case "v5", "v6", "v7":
+			env["GOARM"] = strings.TrimPrefix(p.Variant, "v")
+			return env, nil
+		}
+	case "arm64":
+		if p.Variant == "v8" {
+			return env, nil
+		}
+	case "amd64":
+		switch p.Variant {
+		case "v1", "v2", "v3", "v4":
+			env["GOAMD64"] = p.Variant
+			return env, nil
+		}
+	case "386":
+		switch p.Variant {
+		case "sse2", "softfloat":
+			env["GO386"] = p.Variant
+			return env, nil
+		}
+	case "mips", "mipsle":
+		switch p.Variant {
+		case "hardfloat", "softfloat":
+			env["GOMIPS"] = p.Variant
+			return env, nil
+		}
+	case "mips64", "mips64le":
+		switch p.Variant {
+		case "hardfloat", "softfloat":
+			env["GOMIPS64"] = p.Variant
+			return env, nil
+		}
+	case "ppc64", "ppc64le":
+		switch p.Variant {
+		case "power8", "power9":
+			env["GOPPC64"] = p.Variant
+			return env, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported variant %q for platform %s/%s", p.Variant, p.OS, p.Arch)
+}
+
+// Ext returns the extension of executables for the platform.
+func (p Platform) Ext() string {
+	if p.OS == "windows" {
+		return ".exe"
+	}
+	return ""
+}
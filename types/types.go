@@ -1,24 +1,68 @@
 package types
 
+import "text/template"
+
 type BuildOpts struct {
+	Target     string
 	EnvVars    map[string]string
 	BuildFlags []string
 	Dir        string
 	In         string
+	Sign       *SignOpts
+	Cgo        *CgoOpts
+	Buildmode  string
+	// Pgo is the host path of the profile for profile-guided optimization, mounted in the build container.
+	Pgo string
+	// Secrets are the names of the secrets given to the build container.
+	Secrets []string
+	// Name of the binary, exposed as .Name to the output template.
+	Name string
+	// Version exposed as .Version to the output template.
+	Version string
+	// OutTemplate renders the name of each generated binary.
+	OutTemplate *template.Template
+}
+
+// OutTemplateData is the data available to the output template of a build.
+type OutTemplateData struct {
+	Name    string
+	OS      string
+	Arch    string
+	Variant string
+	Version string
+	Ext     string
+}
+
+type CgoOpts struct {
+	Static bool
+	Cflags string
+}
+
+type SignOpts struct {
+	Image       string
+	Key         string
+	PasswordEnv string
+	Bundle      bool
 }
 
 type LocalBuildOpts struct {
 	BuildOpts
-	Out string
 }
 
 type Platform struct {
-	OS   string
-	Arch string
+	OS      string
+	Arch    string
+	Variant string
 }
 
 type CrossBuildOpts struct {
 	BuildOpts
-	Platforms     []Platform
-	OutFileFormat string
+	Platforms []Platform
+}
+
+// Artifact is a file generated by a build.
+type Artifact struct {
+	Target   string
+	Path     string
+	Platform Platform
 }